@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"p2m-lite/config"
+	"p2m-lite/internal/admin"
 	"p2m-lite/internal/api"
 	"p2m-lite/internal/auth"
+	"p2m-lite/internal/cors"
 	"p2m-lite/internal/database"
+	"p2m-lite/internal/devices"
+	"p2m-lite/internal/notify"
+	"p2m-lite/internal/payout"
+	"p2m-lite/internal/relay"
 	"p2m-lite/internal/worker"
 	"p2m-lite/internal/ws"
 
@@ -18,29 +30,73 @@ func main() {
 	// 1. Load Configuration
 	cfg := config.LoadConfig()
 
+	// SIGINT or SIGTERM cancel ctx, which stops the workers and starts the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// 2. Initialize Database
 	// Initialize SQLite (Real DB)
 	database.InitDB("p2m.db")
 	store := database.NewStore(database.DB)
 
 	// 3. Start Background Workers
-	worker.StartListener(cfg)
-	worker.StartAnalyzer(cfg)
+	notifier, err := notify.FromConfig(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure notification channels: %v", err)
+	}
+	if len(notifier.Channels()) == 0 {
+		log.Println("Warning: No notification channels configured. Quality alerts cannot be delivered.")
+	}
+
+	templates, err := notify.LoadTemplates(cfg.AlertTemplateDir)
+	if err != nil {
+		log.Fatalf("Failed to load alert templates: %v", err)
+	}
+	outbox := worker.StartOutbox(ctx, notifier)
+
+	payer, err := payout.NewService(cfg)
+	if err != nil {
+		log.Printf("Warning: Payout service unavailable, rewards will not be sent: %v", err)
+	} else {
+		payer.OnTrip(func(reason string) {
+			msg, err := worker.OperatorMessage(templates, cfg.AlertLanguage, "Payouts halted", reason)
+			if err == nil {
+				err = outbox.Broadcast(msg)
+			}
+			if err != nil {
+				log.Printf("Failed to notify operators: %v", err)
+			}
+		})
+	}
+	worker.StartListener(ctx, cfg)
+	analyzer := worker.StartAnalyzer(ctx, cfg, payer, outbox, templates)
+	worker.StartConfirmer(ctx, payer)
+	worker.StartDeviceMonitor(ctx)
 
 	// 4. Setup Gin Router
 	r := gin.Default()
 	r.Use(gin.Logger()) // Use default logger for clearer startup
+	// Client IPs come from X-Forwarded-For only when the request passed a trusted proxy
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	policy := cors.NewPolicy(cfg.AllowedOrigins)
+	r.Use(policy.Middleware())
 
 	// 5. Register Modular Routes
 	auth.SetupRoutes(r, cfg, store)
 	api.SetupRoutes(r)
+	admin.SetupRoutes(r, cfg, payer, analyzer, notifier, templates)
+	relay.SetupRoutes(r, cfg, store, payer)
+	devices.SetupRoutes(r, store)
 
 	// 6. WebSocket Route
+	hub := ws.NewHub(policy)
 	r.GET("/logs", func(c *gin.Context) {
-		ws.HandleLogs(c, cfg)
+		hub.HandleLogs(c, cfg)
 	})
 	r.GET("/logs/:Recorder", func(c *gin.Context) {
-		ws.HandleLogs(c, cfg)
+		hub.HandleLogs(c, cfg)
 	})
 
 	// 6. Health Check
@@ -49,6 +105,39 @@ func main() {
 	})
 
 	// 7. Run the server
-	log.Println("Starting P2M-Lite Auth Server on http://localhost:8080")
-	log.Fatal(r.Run(":8080"))
+	srv := newServer(cfg, r)
+	srv.Start()
+
+	// 8. Shut down once a signal arrives, a second one kills the process
+	<-ctx.Done()
+	stop()
+	log.Printf("Shutting down, waiting up to %s for requests, WebSocket clients and workers...", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err = shutdown(shutdownCtx, srv, hub)
+	if payer != nil {
+		payer.Close()
+	}
+	database.Close()
+	if err != nil {
+		log.Fatalf("Shutdown incomplete: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+// shutdown stops accepting connections and waits for open requests, log streams
+// and workers to finish. The workers already stop since their context is cancelled.
+func shutdown(ctx context.Context, srv *server, hub *ws.Hub) error {
+	var errs []error
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := hub.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("WebSocket clients still connected: %w", err))
+	}
+	if err := worker.Wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"p2m-lite/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// readHeaderTimeout bounds how long a client may take to send request headers
+const readHeaderTimeout = 10 * time.Second
+
+// server is the API listener, plain or TLS, plus the HTTP listener answering
+// ACME challenges when certificates come from autocert
+type server struct {
+	http      *http.Server
+	challenge *http.Server
+	serve     func() error
+	scheme    string
+}
+
+func newServer(cfg *config.Config, handler http.Handler) *server {
+	s := &server{
+		http:   &http.Server{Addr: cfg.ListenAddr, Handler: handler, ReadHeaderTimeout: readHeaderTimeout},
+		scheme: "https",
+	}
+
+	switch {
+	case cfg.TLSCertFile != "":
+		s.serve = func() error { return s.http.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile) }
+	case len(cfg.AutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		s.http.TLSConfig = manager.TLSConfig()
+		s.serve = func() error { return s.http.ListenAndServeTLS("", "") }
+		if cfg.AutocertHTTPAddr != "" {
+			s.challenge = &http.Server{Addr: cfg.AutocertHTTPAddr, Handler: manager.HTTPHandler(nil), ReadHeaderTimeout: readHeaderTimeout}
+		}
+	default:
+		s.serve = s.http.ListenAndServe
+		s.scheme = "http"
+	}
+	return s
+}
+
+// Start serves in the background, a listener that cannot start ends the process
+func (s *server) Start() {
+	if s.challenge != nil {
+		go func() {
+			log.Printf("Answering ACME challenges on http://%s", s.challenge.Addr)
+			if err := s.challenge.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("ACME challenge server failed: %v", err)
+			}
+		}()
+	}
+	go func() {
+		log.Printf("Starting P2M-Lite Auth Server on %s://%s", s.scheme, s.http.Addr)
+		if err := s.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+}
+
+// Shutdown stops accepting connections and waits for open requests
+func (s *server) Shutdown(ctx context.Context) error {
+	var errs []error
+	if s.challenge != nil {
+		errs = append(errs, s.challenge.Shutdown(ctx))
+	}
+	if err := s.http.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("HTTP requests still running: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -2,25 +2,114 @@ package config
 
 import (
 	"log"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 const (
-	DefaultTokenTTL  = 600
-	DefaultSecretTTL = 60
+	DefaultTokenTTL       = 600
+	DefaultSecretTTL      = 60
+	DefaultGasLimitMargin = 20
+
+	DefaultRecorderPeriodDays = 30
+
+	DefaultSenderEmail   = "p2m@040203.xyz"
+	DefaultSenderName    = "P2M Bot"
+	DefaultPublicURL     = "http://localhost:8080"
+	DefaultAlertLanguage = "en"
+
+	DefaultShutdownTimeout = 30 * time.Second
+
+	DefaultListenAddr       = ":8080"
+	DefaultAutocertCacheDir = "autocert-cache"
 )
 
 type Config struct {
+	// ListenAddr is the address the API binds to, such as ":8080" or "127.0.0.1:8080"
+	ListenAddr string
+
+	// TLS is served from a certificate and key file, or from certificates
+	// obtained with ACME for AutocertDomains. Both unset means plain HTTP.
+	TLSCertFile      string
+	TLSKeyFile       string
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	// AutocertHTTPAddr answers HTTP-01 challenges and redirects to HTTPS, empty relies on TLS-ALPN-01
+	AutocertHTTPAddr string
+
+	// AllowedOrigins may call the REST API and open WebSockets from a browser.
+	// "*" allows every origin, empty allows the API's own origin only.
+	AllowedOrigins []string
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For headers are
+	// believed, empty means the client IP is the remote address
+	TrustedProxies []string
+
 	AppSecret       string
 	TokenTTL        int
 	SecretTTL       int
 	BlockchainURL   string
 	ContractAddress string
-	BrevoAPIKey     string
-	PrivateKey      string
+	// ForwarderAddress is the trusted forwarder meta-transactions of recorders are relayed through
+	ForwarderAddress string
+	BrevoAPIKey      string
+	PrivateKey       string
+
+	// Fee settings for payout transactions. A nil cap means "no cap".
+	MaxFeePerGas   *big.Int
+	MaxTipPerGas   *big.Int
+	GasLimitMargin int    // percent added on top of the gas estimate
+	CycleGasBudget uint64 // gas units an analyzer cycle may spend on payouts, 0 = unlimited
+	// RelayDailyGasBudget is the gas relay transactions may use per 24 hours before
+	// the breaker halts payouts and relaying, 0 = unlimited
+	RelayDailyGasBudget uint64
+
+	// Payout budgets in wei. A nil budget means "unlimited".
+	PayoutCycleBudget        *big.Int
+	PayoutDailyBudget        *big.Int
+	PayoutRecorderBudget     *big.Int
+	PayoutRecorderPeriodDays int
+	MinTreasuryBalance       *big.Int
+
+	AdminToken string
+
+	// AnalyzerDryRun makes scheduled analyzer runs record decisions without acting on them
+	AnalyzerDryRun bool
+	// AnalyzerSchedule is an interval ("10m", "@every 6h") or a 5-field cron expression
+	AnalyzerSchedule   string
+	AnalyzerRunOnStart bool
+
+	// PublicURL is where this API is reachable from the outside, used for links in alerts
+	PublicURL string
+
+	// AlertTemplateDir overrides the built-in message templates, AlertLanguage is
+	// the language of alerts sent to default recipients
+	AlertTemplateDir string
+	AlertLanguage    string
+
+	// Notification channels. A channel is enabled when its URL or token is set.
+	AlertEmail        string // default recipient of email channels
+	SenderEmail       string
+	SenderName        string
+	BrevoAPIURL       string
+	SMTPURL           string
+	SlackWebhookURL   string
+	DiscordWebhookURL string
+	WebhookURL        string
+	WebhookSecret     string
+	TelegramAPIURL    string
+	TelegramBotToken  string
+	TelegramChatID    string
+
+	// ShutdownTimeout bounds draining requests, WebSocket clients and workers after SIGTERM
+	ShutdownTimeout time.Duration
 }
 
 func LoadConfig() *Config {
@@ -29,19 +118,54 @@ func LoadConfig() *Config {
 	}
 
 	appConfig := &Config{
-		AppSecret:       os.Getenv("APP_SECRET"),
-		TokenTTL:        DefaultTokenTTL,
-		SecretTTL:       DefaultSecretTTL,
-		BlockchainURL:   os.Getenv("BLOCKCHAIN_URL"),
-		ContractAddress: os.Getenv("CONTRACT_ADDRESS"),
-		BrevoAPIKey:     os.Getenv("BREVO_API_KEY"),
-		PrivateKey:      os.Getenv("PRIVATE_KEY"),
+		ListenAddr:       envOr("LISTEN_ADDR", DefaultListenAddr),
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		AutocertDomains:  listEnv("AUTOCERT_DOMAINS"),
+		AutocertEmail:    os.Getenv("AUTOCERT_EMAIL"),
+		AutocertCacheDir: envOr("AUTOCERT_CACHE_DIR", DefaultAutocertCacheDir),
+		AutocertHTTPAddr: os.Getenv("AUTOCERT_HTTP_ADDR"),
+		AllowedOrigins:   listEnv("ALLOWED_ORIGINS"),
+		TrustedProxies:   listEnv("TRUSTED_PROXIES"),
+
+		AppSecret:        os.Getenv("APP_SECRET"),
+		TokenTTL:         DefaultTokenTTL,
+		SecretTTL:        DefaultSecretTTL,
+		BlockchainURL:    os.Getenv("BLOCKCHAIN_URL"),
+		ContractAddress:  os.Getenv("CONTRACT_ADDRESS"),
+		ForwarderAddress: os.Getenv("FORWARDER_ADDRESS"),
+		BrevoAPIKey:      os.Getenv("BREVO_API_KEY"),
+		PrivateKey:       os.Getenv("PRIVATE_KEY"),
+		GasLimitMargin:   DefaultGasLimitMargin,
+		AdminToken:       os.Getenv("ADMIN_TOKEN"),
+		AnalyzerSchedule: os.Getenv("ANALYZER_SCHEDULE"),
+
+		PublicURL:         strings.TrimSuffix(envOr("PUBLIC_URL", DefaultPublicURL), "/"),
+		AlertTemplateDir:  os.Getenv("ALERT_TEMPLATE_DIR"),
+		AlertLanguage:     envOr("ALERT_LANGUAGE", DefaultAlertLanguage),
+		AlertEmail:        os.Getenv("ALERT_EMAIL"),
+		SenderEmail:       envOr("SENDER_EMAIL", DefaultSenderEmail),
+		SenderName:        envOr("SENDER_NAME", DefaultSenderName),
+		BrevoAPIURL:       os.Getenv("BREVO_API_URL"),
+		SMTPURL:           os.Getenv("SMTP_URL"),
+		SlackWebhookURL:   os.Getenv("SLACK_WEBHOOK_URL"),
+		DiscordWebhookURL: os.Getenv("DISCORD_WEBHOOK_URL"),
+		WebhookURL:        os.Getenv("WEBHOOK_URL"),
+		WebhookSecret:     os.Getenv("WEBHOOK_SECRET"),
+		TelegramAPIURL:    os.Getenv("TELEGRAM_API_URL"),
+		TelegramBotToken:  os.Getenv("TELEGRAM_BOT_TOKEN"),
+		TelegramChatID:    os.Getenv("TELEGRAM_CHAT_ID"),
+
+		PayoutRecorderPeriodDays: DefaultRecorderPeriodDays,
+		ShutdownTimeout:          DefaultShutdownTimeout,
 	}
 
 	if appConfig.AppSecret == "" {
 		log.Fatal("APP_SECRET is not set in environment or .env file. The server cannot run without it.")
 	}
 
+	loadNetworkConfig(appConfig)
+
 	if appConfig.BlockchainURL == "" {
 		log.Println("Warning: BLOCKCHAIN_URL is not set. WebSocket functionality may fail.")
 	}
@@ -50,6 +174,10 @@ func LoadConfig() *Config {
 		log.Println("Warning: CONTRACT_ADDRESS is not set. WebSocket functionality may fail.")
 	}
 
+	if appConfig.ForwarderAddress == "" {
+		log.Println("Warning: FORWARDER_ADDRESS is not set. Recorders cannot submit readings through the relay.")
+	}
+
 	if ttlStr := os.Getenv("TOKEN_TTL"); ttlStr != "" {
 		if ttl, err := strconv.Atoi(ttlStr); err == nil {
 			appConfig.TokenTTL = ttl
@@ -66,7 +194,170 @@ func LoadConfig() *Config {
 		}
 	}
 
+	if marginStr := os.Getenv("GAS_LIMIT_MARGIN"); marginStr != "" {
+		if margin, err := strconv.Atoi(marginStr); err == nil && margin >= 0 {
+			appConfig.GasLimitMargin = margin
+		} else {
+			log.Printf("Warning: Invalid GAS_LIMIT_MARGIN value '%s'. Using default: %d%%.", marginStr, DefaultGasLimitMargin)
+		}
+	}
+
+	if budgetStr := os.Getenv("CYCLE_GAS_BUDGET"); budgetStr != "" {
+		budget, err := strconv.ParseUint(budgetStr, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid CYCLE_GAS_BUDGET value '%s'. Use a whole number of gas units, or leave it unset for no limit.", budgetStr)
+		}
+		appConfig.CycleGasBudget = budget
+	}
+
+	if budgetStr := os.Getenv("RELAY_DAILY_GAS_BUDGET"); budgetStr != "" {
+		budget, err := strconv.ParseUint(budgetStr, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid RELAY_DAILY_GAS_BUDGET value '%s'. Use a whole number of gas units, or leave it unset for no limit.", budgetStr)
+		}
+		appConfig.RelayDailyGasBudget = budget
+	}
+
+	// Caps on the operator key fail closed like the daemon's: a typo must not lift them
+	appConfig.MaxFeePerGas = amountEnv("MAX_FEE_GWEI", gwei)
+	appConfig.MaxTipPerGas = amountEnv("MAX_TIP_GWEI", gwei)
+	if appConfig.MaxFeePerGas != nil && appConfig.MaxFeePerGas.Sign() == 0 {
+		log.Fatal("MAX_FEE_GWEI must be above 0, leave it unset for no cap.")
+	}
+	if appConfig.MaxFeePerGas != nil && appConfig.MaxTipPerGas != nil && appConfig.MaxTipPerGas.Cmp(appConfig.MaxFeePerGas) > 0 {
+		log.Fatalf("MAX_TIP_GWEI (%s) must not exceed MAX_FEE_GWEI (%s).", os.Getenv("MAX_TIP_GWEI"), os.Getenv("MAX_FEE_GWEI"))
+	}
+
+	appConfig.PayoutCycleBudget = amountEnv("PAYOUT_CYCLE_BUDGET_BNB", bnb)
+	appConfig.PayoutDailyBudget = amountEnv("PAYOUT_DAILY_BUDGET_BNB", bnb)
+	appConfig.PayoutRecorderBudget = amountEnv("PAYOUT_RECORDER_BUDGET_BNB", bnb)
+	appConfig.MinTreasuryBalance = amountEnv("MIN_TREASURY_BALANCE_BNB", bnb)
+
+	if daysStr := os.Getenv("PAYOUT_RECORDER_PERIOD_DAYS"); daysStr != "" {
+		if days, err := strconv.Atoi(daysStr); err == nil && days > 0 {
+			appConfig.PayoutRecorderPeriodDays = days
+		} else {
+			log.Printf("Warning: Invalid PAYOUT_RECORDER_PERIOD_DAYS value '%s'. Using default: %d days.", daysStr, DefaultRecorderPeriodDays)
+		}
+	}
+
+	if dryRunStr := os.Getenv("ANALYZER_DRY_RUN"); dryRunStr != "" {
+		if dryRun, err := strconv.ParseBool(dryRunStr); err == nil {
+			appConfig.AnalyzerDryRun = dryRun
+		} else {
+			log.Printf("Warning: Invalid ANALYZER_DRY_RUN value '%s'. Dry run is disabled.", dryRunStr)
+		}
+	}
+	if runStr := os.Getenv("ANALYZER_RUN_ON_START"); runStr != "" {
+		if run, err := strconv.ParseBool(runStr); err == nil {
+			appConfig.AnalyzerRunOnStart = run
+		} else {
+			log.Printf("Warning: Invalid ANALYZER_RUN_ON_START value '%s'. The first cycle waits for the schedule.", runStr)
+		}
+	}
+
+	if timeoutStr := os.Getenv("SHUTDOWN_TIMEOUT"); timeoutStr != "" {
+		if timeout, err := time.ParseDuration(timeoutStr); err == nil && timeout > 0 {
+			appConfig.ShutdownTimeout = timeout
+		} else {
+			log.Printf("Warning: Invalid SHUTDOWN_TIMEOUT value '%s'. Using default: %s.", timeoutStr, DefaultShutdownTimeout)
+		}
+	}
+
+	if appConfig.AnalyzerDryRun {
+		log.Println("Warning: ANALYZER_DRY_RUN is enabled. No alerts or rewards will be sent.")
+	}
+
+	if appConfig.AdminToken == "" {
+		log.Println("Warning: ADMIN_TOKEN is not set. Admin endpoints are disabled.")
+	}
+
 	log.Printf("Config loaded: Token TTL=%d, Secret TTL=%d", appConfig.TokenTTL, appConfig.SecretTTL)
 
 	return appConfig
 }
+
+// loadNetworkConfig validates the listener settings. Mistakes here would expose
+// the API in unintended ways, so they are fatal instead of falling back.
+func loadNetworkConfig(appConfig *Config) {
+	if _, port, err := net.SplitHostPort(appConfig.ListenAddr); err != nil || port == "" {
+		log.Fatalf("Invalid LISTEN_ADDR value '%s'. Use host:port such as :8080 or 127.0.0.1:8080.", appConfig.ListenAddr)
+	}
+
+	if (appConfig.TLSCertFile == "") != (appConfig.TLSKeyFile == "") {
+		log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together.")
+	}
+	if appConfig.TLSCertFile != "" && len(appConfig.AutocertDomains) > 0 {
+		log.Fatal("Set either TLS_CERT_FILE and TLS_KEY_FILE or AUTOCERT_DOMAINS, not both.")
+	}
+	if appConfig.AutocertHTTPAddr != "" {
+		if len(appConfig.AutocertDomains) == 0 {
+			log.Fatal("AUTOCERT_HTTP_ADDR needs AUTOCERT_DOMAINS.")
+		}
+		if _, _, err := net.SplitHostPort(appConfig.AutocertHTTPAddr); err != nil {
+			log.Fatalf("Invalid AUTOCERT_HTTP_ADDR value '%s'. Use host:port such as :80.", appConfig.AutocertHTTPAddr)
+		}
+	}
+
+	for i, origin := range appConfig.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" {
+			log.Fatalf("Invalid ALLOWED_ORIGINS entry '%s'. Use scheme://host[:port] such as https://dashboard.example.com.", origin)
+		}
+		// Browsers send origins without a trailing slash and in lower case
+		appConfig.AllowedOrigins[i] = strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	if len(appConfig.AllowedOrigins) == 0 {
+		log.Println("Warning: ALLOWED_ORIGINS is not set. Browsers may only use the API from its own origin.")
+	}
+
+	for _, proxy := range appConfig.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				log.Fatalf("Invalid TRUSTED_PROXIES entry '%s'. Use an IP or a CIDR such as 10.0.0.0/8.", proxy)
+			}
+		}
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// listEnv splits a comma separated variable, skipping empty entries
+func listEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+var (
+	gwei = big.NewRat(1_000_000_000, 1)
+	bnb  = new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+)
+
+// amountEnv reads a (possibly fractional) amount in the given unit and returns it in wei.
+// Unset values yield nil, which callers treat as "no limit". Invalid values are fatal,
+// falling back to no limit would silently disable the guardrail.
+func amountEnv(name string, unit *big.Rat) *big.Int {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	amount, ok := new(big.Rat).SetString(value)
+	if !ok || amount.Sign() < 0 {
+		log.Fatalf("Invalid %s value '%s'. Use a non-negative decimal amount such as 0.5, or leave it unset for no limit.", name, value)
+	}
+	wei := new(big.Rat).Mul(amount, unit)
+	return new(big.Int).Quo(wei.Num(), wei.Denom())
+}
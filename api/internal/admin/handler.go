@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/internal/payout"
+	"p2m-lite/internal/worker"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	payer     *payout.Service
+	analyzer  *worker.Analyzer
+	notifier  *notify.Dispatcher
+	templates *notify.Templates
+}
+
+func NewHandler(payer *payout.Service, analyzer *worker.Analyzer, notifier *notify.Dispatcher, templates *notify.Templates) *AdminHandler {
+	return &AdminHandler{payer: payer, analyzer: analyzer, notifier: notifier, templates: templates}
+}
+
+func (h *AdminHandler) GetBreaker(c *gin.Context) {
+	if h.payer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payout service unavailable"})
+		return
+	}
+
+	open, reason, since := h.payer.Breaker().State()
+	response := gin.H{"open": open}
+	if open {
+		response["reason"] = reason
+		response["since"] = since.Unix()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AdminHandler) ResetBreaker(c *gin.Context) {
+	if h.payer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payout service unavailable"})
+		return
+	}
+
+	h.payer.Breaker().Reset()
+	c.JSON(http.StatusOK, gin.H{"message": "Payouts resumed"})
+}
+
+type RunAnalyzerRequest struct {
+	Recorder string `json:"recorder"`
+	DryRun   bool   `json:"dry_run"`
+}
+
+// RunAnalyzer triggers an analyzer cycle right now, optionally for a single recorder
+func (h *AdminHandler) RunAnalyzer(c *gin.Context) {
+	var req RunAnalyzerRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+			return
+		}
+	}
+	if req.Recorder != "" && !common.IsHexAddress(req.Recorder) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recorder address"})
+		return
+	}
+
+	run, err := h.analyzer.Run(worker.RunOptions{
+		DryRun:   req.DryRun,
+		Recorder: req.Recorder,
+		Trigger:  database.TriggerManual,
+	})
+	if errors.Is(err, worker.ErrAnalyzerBusy) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, worker.ErrAnalyzerStopped) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to run analyzer"})
+		return
+	}
+
+	decisions, err := database.DecisionsForRun(run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch decisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"run_id":    run.ID,
+		"dry_run":   run.DryRun,
+		"decisions": database.NewDecisionResponses(decisions),
+	})
+}
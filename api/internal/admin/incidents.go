@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"p2m-lite/internal/database"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+type IncidentResponse struct {
+	ID             uint    `json:"id"`
+	Recorder       string  `json:"recorder"`
+	Status         string  `json:"status"`
+	Severity       string  `json:"severity"`
+	Reason         string  `json:"reason"`
+	AvgPH          float64 `json:"avg_ph"`
+	AvgTurbidity   float64 `json:"avg_turbidity"`
+	OpenedAt       int64   `json:"opened_at"`
+	LastSeenAt     int64   `json:"last_seen_at"`
+	AcknowledgedAt int64   `json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string  `json:"acknowledged_by,omitempty"`
+	EscalatedAt    int64   `json:"escalated_at,omitempty"`
+	ResolvedAt     int64   `json:"resolved_at,omitempty"`
+}
+
+func newIncidentResponse(i database.Incident) IncidentResponse {
+	return IncidentResponse{
+		ID:             i.ID,
+		Recorder:       i.Recorder,
+		Status:         i.Status,
+		Severity:       i.Severity,
+		Reason:         i.Reason,
+		AvgPH:          i.AvgPH,
+		AvgTurbidity:   i.AvgTurbidity,
+		OpenedAt:       i.OpenedAt,
+		LastSeenAt:     i.LastSeenAt,
+		AcknowledgedAt: i.AcknowledgedAt,
+		AcknowledgedBy: i.AcknowledgedBy,
+		EscalatedAt:    i.EscalatedAt,
+		ResolvedAt:     i.ResolvedAt,
+	}
+}
+
+// ListIncidents supports ?status=open|acknowledged|resolved, ?recorder= and ?limit=
+func (h *AdminHandler) ListIncidents(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", database.IncidentOpen, database.IncidentAcknowledged, database.IncidentResolved:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	recorder := c.Query("recorder")
+	if recorder != "" {
+		if !common.IsHexAddress(recorder) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recorder address"})
+			return
+		}
+		recorder = common.HexToAddress(recorder).Hex()
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	incidents, err := database.ListIncidents(status, recorder, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incidents"})
+		return
+	}
+
+	response := []IncidentResponse{}
+	for _, i := range incidents {
+		response = append(response, newIncidentResponse(i))
+	}
+	c.JSON(http.StatusOK, gin.H{"incidents": response})
+}
+
+type AcknowledgeRequest struct {
+	By string `json:"by" binding:"required"`
+}
+
+// AcknowledgeIncident stops escalation of an open incident. It resolves on its own once readings recover.
+func (h *AdminHandler) AcknowledgeIncident(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid incident id"})
+		return
+	}
+	var req AcknowledgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+
+	acked, err := database.AcknowledgeIncident(uint(id), req.By)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acknowledge incident"})
+		return
+	}
+	if !acked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Open incident not found"})
+		return
+	}
+
+	incident, err := database.GetIncident(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch incident"})
+		return
+	}
+	c.JSON(http.StatusOK, newIncidentResponse(*incident))
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"p2m-lite/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationResponse struct {
+	ID            uint   `json:"id"`
+	Channel       string `json:"channel"`
+	Recipient     string `json:"recipient,omitempty"`
+	Subject       string `json:"subject"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at,omitempty"`
+	LastError     string `json:"last_error,omitempty"`
+	SentAt        int64  `json:"sent_at,omitempty"`
+	CreatedAt     int64  `json:"created_at"`
+}
+
+// ListNotifications shows the outbox, optionally filtered by ?status=pending|sent|dead
+func (h *AdminHandler) ListNotifications(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", database.NotificationPending, database.NotificationSent, database.NotificationDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	limit := 100
+	if l, err := strconv.Atoi(c.Query("limit")); err == nil && l > 0 && l <= 500 {
+		limit = l
+	}
+
+	notifications, err := database.ListNotifications(status, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+
+	response := []NotificationResponse{}
+	for _, n := range notifications {
+		next := n.NextAttemptAt
+		if n.Status != database.NotificationPending {
+			next = 0
+		}
+		response = append(response, NotificationResponse{
+			ID:            n.ID,
+			Channel:       n.Channel,
+			Recipient:     n.Recipient,
+			Subject:       n.Subject,
+			Status:        n.Status,
+			Attempts:      n.Attempts,
+			NextAttemptAt: next,
+			LastError:     n.LastError,
+			SentAt:        n.SentAt,
+			CreatedAt:     n.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": response})
+}
+
+// RetryNotification moves a dead-lettered notification back into the outbox
+func (h *AdminHandler) RetryNotification(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification id"})
+		return
+	}
+
+	found, err := database.RequeueNotification(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to requeue notification"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead notification not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification requeued"})
+}
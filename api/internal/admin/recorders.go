@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"net/http"
+
+	"p2m-lite/internal/database"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+type RecorderRequest struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type RecorderResponse struct {
+	Address string  `json:"address"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+func (h *AdminHandler) ListRecorders(c *gin.Context) {
+	recorders, err := database.ListRecorders()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recorders"})
+		return
+	}
+
+	response := []RecorderResponse{}
+	for _, r := range recorders {
+		response = append(response, RecorderResponse{Address: r.Address, Lat: r.Lat, Lon: r.Lon})
+	}
+	c.JSON(http.StatusOK, gin.H{"recorders": response})
+}
+
+// RegisterRecorder adds a recorder with its location, which also lets it relay readings
+func (h *AdminHandler) RegisterRecorder(c *gin.Context) {
+	address := c.Param("address")
+	if !common.IsHexAddress(address) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recorder address"})
+		return
+	}
+	var req RecorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if req.Lat < -90 || req.Lat > 90 || req.Lon < -180 || req.Lon > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Latitude or longitude out of range"})
+		return
+	}
+
+	recorder := common.HexToAddress(address).Hex()
+	if err := database.RegisterRecorder(recorder, req.Lat, req.Lon); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register recorder"})
+		return
+	}
+	c.JSON(http.StatusOK, RecorderResponse{Address: recorder, Lat: req.Lat, Lon: req.Lon})
+}
@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"p2m-lite/config"
+	"p2m-lite/internal/notify"
+	"p2m-lite/internal/payout"
+	"p2m-lite/internal/worker"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupRoutes(r *gin.Engine, cfg *config.Config, payer *payout.Service, analyzer *worker.Analyzer, notifier *notify.Dispatcher, templates *notify.Templates) {
+	handler := NewHandler(payer, analyzer, notifier, templates)
+	adminGroup := r.Group("/admin", RequireToken(cfg.AdminToken))
+	{
+		adminGroup.GET("/payouts/breaker", handler.GetBreaker)
+		adminGroup.POST("/payouts/breaker/reset", handler.ResetBreaker)
+		adminGroup.POST("/analyzer/run", handler.RunAnalyzer)
+		adminGroup.GET("/recorders", handler.ListRecorders)
+		adminGroup.PUT("/recorders/:address", handler.RegisterRecorder)
+		adminGroup.GET("/subscriptions", handler.ListSubscriptions)
+		adminGroup.POST("/subscriptions", handler.CreateSubscription)
+		adminGroup.DELETE("/subscriptions/:id", handler.DeleteSubscription)
+		adminGroup.GET("/incidents", handler.ListIncidents)
+		adminGroup.POST("/incidents/:id/ack", handler.AcknowledgeIncident)
+		adminGroup.GET("/notifications", handler.ListNotifications)
+		adminGroup.POST("/notifications/:id/retry", handler.RetryNotification)
+	}
+}
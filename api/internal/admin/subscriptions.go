@@ -0,0 +1,171 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/internal/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+type SubscriptionRequest struct {
+	Recipient   string   `json:"recipient" binding:"required"`
+	Channel     string   `json:"channel" binding:"required"`
+	Recorder    string   `json:"recorder"`
+	MinLat      *float64 `json:"min_lat"`
+	MinLon      *float64 `json:"min_lon"`
+	MaxLat      *float64 `json:"max_lat"`
+	MaxLon      *float64 `json:"max_lon"`
+	MinSeverity string   `json:"min_severity"`
+	Language    string   `json:"language"`
+}
+
+type SubscriptionResponse struct {
+	ID          uint     `json:"id"`
+	Recipient   string   `json:"recipient"`
+	Channel     string   `json:"channel"`
+	Recorder    string   `json:"recorder,omitempty"`
+	MinLat      *float64 `json:"min_lat,omitempty"`
+	MinLon      *float64 `json:"min_lon,omitempty"`
+	MaxLat      *float64 `json:"max_lat,omitempty"`
+	MaxLon      *float64 `json:"max_lon,omitempty"`
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	CreatedAt   int64    `json:"created_at"`
+}
+
+func newSubscriptionResponse(s database.Subscription) SubscriptionResponse {
+	return SubscriptionResponse{
+		ID:          s.ID,
+		Recipient:   s.Recipient,
+		Channel:     s.Channel,
+		Recorder:    s.Recorder,
+		MinLat:      s.MinLat,
+		MinLon:      s.MinLon,
+		MaxLat:      s.MaxLat,
+		MaxLon:      s.MaxLon,
+		MinSeverity: s.MinSeverity,
+		Language:    s.Language,
+		CreatedAt:   s.CreatedAt,
+	}
+}
+
+func (h *AdminHandler) ListSubscriptions(c *gin.Context) {
+	subs, err := database.ListSubscriptions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch subscriptions"})
+		return
+	}
+
+	response := []SubscriptionResponse{}
+	for _, s := range subs {
+		response = append(response, newSubscriptionResponse(s))
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": response})
+}
+
+func (h *AdminHandler) CreateSubscription(c *gin.Context) {
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload: " + err.Error()})
+		return
+	}
+	if err := h.validateSubscription(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := utils.GenerateRandomBytes(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	// Logs store checksummed addresses, so subscriptions do too
+	recorder := req.Recorder
+	if recorder != "" {
+		recorder = common.HexToAddress(recorder).Hex()
+	}
+
+	sub := database.Subscription{
+		Recipient:   req.Recipient,
+		Channel:     req.Channel,
+		Recorder:    recorder,
+		MinLat:      req.MinLat,
+		MinLon:      req.MinLon,
+		MaxLat:      req.MaxLat,
+		MaxLon:      req.MaxLon,
+		MinSeverity: req.MinSeverity,
+		Language:    req.Language,
+		Token:       fmt.Sprintf("%x", token),
+	}
+	if err := database.CreateSubscription(&sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create subscription"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, newSubscriptionResponse(sub))
+}
+
+func (h *AdminHandler) DeleteSubscription(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subscription id"})
+		return
+	}
+
+	found, err := database.DeleteSubscription(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete subscription"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted"})
+}
+
+func (h *AdminHandler) validateSubscription(req SubscriptionRequest) error {
+	if h.notifier.Channel(req.Channel) == nil {
+		return fmt.Errorf("channel %q is not enabled on this server", req.Channel)
+	}
+	if err := notify.ValidateRecipient(req.Channel, req.Recipient); err != nil {
+		return err
+	}
+	if req.MinSeverity != "" && !notify.ValidSeverity(req.MinSeverity) {
+		return fmt.Errorf("invalid min_severity %q", req.MinSeverity)
+	}
+	if req.Language != "" && !h.templates.HasLanguage(req.Language) {
+		return fmt.Errorf("no templates for language %q, available: %s", req.Language, strings.Join(h.templates.Languages(), ", "))
+	}
+	if req.Recorder != "" && !common.IsHexAddress(req.Recorder) {
+		return fmt.Errorf("invalid recorder address")
+	}
+
+	box := []*float64{req.MinLat, req.MinLon, req.MaxLat, req.MaxLon}
+	set := 0
+	for _, v := range box {
+		if v != nil {
+			set++
+		}
+	}
+	if set != 0 && set != len(box) {
+		return fmt.Errorf("a bounding box needs min_lat, min_lon, max_lat and max_lon")
+	}
+	if set == len(box) {
+		if req.Recorder != "" {
+			return fmt.Errorf("a subscription is scoped to either a recorder or a bounding box, not both")
+		}
+		if *req.MinLat > *req.MaxLat || *req.MinLon > *req.MaxLon {
+			return fmt.Errorf("bounding box minimums must not exceed maximums")
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"errors"
+	"html/template"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,6 +10,7 @@ import (
 	"p2m-lite/internal/database"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func SetupRoutes(r *gin.Engine) {
@@ -15,6 +18,11 @@ func SetupRoutes(r *gin.Engine) {
 	{
 		api.GET("/logs/history", GetLogsHistory)
 		api.GET("/recorders", GetRecorders)
+		api.GET("/recorders/:address/rewards", GetRecorderRewards)
+		api.GET("/recorders/:address/decisions", GetRecorderDecisions)
+		api.GET("/analyzer/decisions", GetLatestDecisions)
+		api.GET("/subscriptions/unsubscribe", ConfirmUnsubscribe)
+		api.POST("/subscriptions/unsubscribe", Unsubscribe)
 	}
 }
 
@@ -84,3 +92,132 @@ func GetRecorders(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"recorders": response})
 }
+
+func GetRecorderRewards(c *gin.Context) {
+	type RewardResponse struct {
+		Amount      string `json:"amount"`
+		TxHash      string `json:"tx_hash"`
+		Nonce       uint64 `json:"nonce"`
+		Status      string `json:"status"`
+		BlockNumber uint64 `json:"block_number,omitempty"`
+		GasUsed     uint64 `json:"gas_used,omitempty"`
+		CreatedAt   int64  `json:"created_at"`
+		UpdatedAt   int64  `json:"updated_at"`
+	}
+
+	rewards, err := database.RewardsForRecorder(c.Param("address"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rewards"})
+		return
+	}
+
+	response := []RewardResponse{}
+	for _, r := range rewards {
+		response = append(response, RewardResponse{
+			Amount:      r.Amount,
+			TxHash:      r.TxHash,
+			Nonce:       r.Nonce,
+			Status:      r.Status,
+			BlockNumber: r.BlockNumber,
+			GasUsed:     r.GasUsed,
+			CreatedAt:   r.CreatedAt,
+			UpdatedAt:   r.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rewards": response})
+}
+
+// GetLatestDecisions returns the decisions of the last analyzer run (?dry_run=true for the last dry run)
+func GetLatestDecisions(c *gin.Context) {
+	dryRunOnly := c.Query("dry_run") == "true"
+
+	run, err := database.LatestAnalyzerRun(dryRunOnly)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No analyzer run found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch analyzer run"})
+		return
+	}
+
+	decisions, err := database.DecisionsForRun(run.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch decisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"run_id":      run.ID,
+		"dry_run":     run.DryRun,
+		"started_at":  run.StartedAt,
+		"finished_at": run.FinishedAt,
+		"decisions":   database.NewDecisionResponses(decisions),
+	})
+}
+
+// GetRecorderDecisions explains what the analyzer did for a recorder and why
+func GetRecorderDecisions(c *gin.Context) {
+	limit := 50 // Default
+	if limitStr := c.Query("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = l
+		}
+	}
+
+	decisions, err := database.DecisionsForRecorder(c.Param("address"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch decisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"decisions": database.NewDecisionResponses(decisions)})
+}
+
+// unsubscribePage asks for confirmation, so mail scanners that follow the link do not unsubscribe
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+<p>Stop receiving P2M-Lite water quality alerts?</p>
+<form method="post"><input type="hidden" name="token" value="{{.}}"><button type="submit">Unsubscribe</button></form>
+</body></html>
+`))
+
+// ConfirmUnsubscribe is the target of the link in every alert sent to a subscriber
+func ConfirmUnsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := unsubscribePage.Execute(c.Writer, token); err != nil {
+		c.Error(err)
+	}
+}
+
+// Unsubscribe removes a subscription, from the confirmation form or a one-click
+// unsubscribe POST to the link itself
+func Unsubscribe(c *gin.Context) {
+	token := c.PostForm("token")
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	found, err := database.DeleteSubscriptionByToken(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsubscribe"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found or already removed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "You have been unsubscribed"})
+}
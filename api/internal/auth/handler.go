@@ -49,7 +49,7 @@ func (h *AuthHandler) VerifyAuth(c *gin.Context) {
         return
     }
 
-    sessionToken, err := h.service.CompleteAuthAndIssueToken(req.SignedChallenge, req.KeyData)
+    sessionToken, expiry, err := h.service.CompleteAuthAndIssueToken(req.SignedChallenge, req.KeyData)
     if err != nil {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed: " + err.Error()})
         return
@@ -58,5 +58,6 @@ func (h *AuthHandler) VerifyAuth(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{
         "message":       "Authentication successful",
         "session_token": sessionToken,
+        "expires_at":    expiry.Unix(),
     })
 }
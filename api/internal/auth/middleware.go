@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/utils"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+const recorderKey = "recorder"
+
+// RequireSession guards device routes with a session token issued by /auth/verify.
+// The recorder address derived from the session's public key is stored in the context.
+func RequireSession(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing session token"})
+			return
+		}
+
+		session, err := db.ActiveSession(token, time.Now())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session token"})
+			return
+		}
+
+		publicKey, err := utils.ParseWeb3PublicKey(session.PublicKey)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session key is not a valid recorder key"})
+			return
+		}
+
+		c.Set(recorderKey, crypto.PubkeyToAddress(*publicKey))
+		c.Next()
+	}
+}
+
+// Recorder returns the address of the device authenticated by RequireSession
+func Recorder(c *gin.Context) common.Address {
+	return c.MustGet(recorderKey).(common.Address)
+}
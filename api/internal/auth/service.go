@@ -60,12 +60,12 @@ func (s *AuthService) InitiateChallenge(publicKey string) (randomString, base64V
 	return randomString, base64Value, nil
 }
 
-func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 string) (sessionToken string, err error) {
+func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 string) (sessionToken string, expiry time.Time, err error) {
 	log.Println("AUTH: Starting Verification (ECDSA secp256k1 - Web3 Standard).")
 
 	decodedData, err := utils.DecodeAndExtractChallengeData(keyDataB64, s.cfg.AppSecret)
 	if err != nil {
-		return "", fmt.Errorf("decryption/decoding failed: %w", err)
+		return "", time.Time{}, fmt.Errorf("decryption/decoding failed: %w", err)
 	}
 
 	publicKeyPEM := decodedData.PublicKey
@@ -77,19 +77,19 @@ func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 s
 
 	challengeTime, err := strconv.ParseInt(timestampStr, 10, 64)
 	if err != nil {
-		return "", errors.New("invalid timestamp format in key data")
+		return "", time.Time{}, errors.New("invalid timestamp format in key data")
 	}
 
 	expiryTime := time.Unix(challengeTime, 0).Add(time.Duration(s.cfg.SecretTTL) * time.Second)
 	if time.Now().After(expiryTime) {
 		log.Printf("AUTH: Challenge rejected. Expired at %s (Secret TTL: %d seconds).", expiryTime.Format(time.RFC3339), s.cfg.SecretTTL)
-		return "", errors.New("authentication challenge expired")
+		return "", time.Time{}, errors.New("authentication challenge expired")
 	}
 	log.Println("AUTH: Timestamp check PASSED.")
 
 	ecdsaPubKey, err := utils.ParseWeb3PublicKey(publicKeyPEM)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse public key: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to parse public key: %w", err)
 	}
 	log.Println("AUTH: Parsed ECDSA Public Key successfully.")
 
@@ -98,7 +98,7 @@ func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 s
 
 	signature, err := utils.Base64Decode(signedChallengeB64)
 	if err != nil {
-		return "", errors.New("invalid base64 signed challenge")
+		return "", time.Time{}, errors.New("invalid base64 signed challenge")
 	}
 
 	challengeBytes := []byte(originalChallengeHex)
@@ -109,7 +109,7 @@ func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 s
 
 	if len(signature) != signatureLength {
 		log.Printf("AUTH: Signature length mismatch. Expected %d bytes, got %d. (Web3 signature length)", signatureLength, len(signature))
-		return "", errors.New("invalid signature length")
+		return "", time.Time{}, errors.New("invalid signature length")
 	}
 
 	rSig := new(big.Int).SetBytes(signature[:keyBytes])
@@ -117,7 +117,7 @@ func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 s
 
 	if !ecdsa.Verify(ecdsaPubKey, hashedChallenge[:], rSig, sSig) {
 		log.Printf("AUTH: Signature verification FAILED using standard ECDSA.")
-		return "", errors.New("signature verification failed. The challenge was not signed by the private key")
+		return "", time.Time{}, errors.New("signature verification failed. The challenge was not signed by the private key")
 	}
 	log.Println("AUTH: Signature verification PASSED.")
 
@@ -128,13 +128,13 @@ func (s *AuthService) CompleteAuthAndIssueToken(signedChallengeB64, keyDataB64 s
 
 	sessionToken, err = utils.GenerateToken(publicKeyPEM, s.cfg.AppSecret, s.cfg.TokenTTL)
 	if err != nil {
-		return "", errors.New("failed to generate session token")
+		return "", time.Time{}, errors.New("failed to generate session token")
 	}
 
-	expiry := time.Now().Add(time.Duration(s.cfg.TokenTTL) * time.Second)
+	expiry = time.Now().Add(time.Duration(s.cfg.TokenTTL) * time.Second)
 	s.db.StoreSession(publicKeyPEM, sessionToken, expiry)
 
 	log.Printf("AUTH: Token issued. Token TTL: %d seconds.", s.cfg.TokenTTL)
 
-	return sessionToken, nil
+	return sessionToken, expiry, nil
 }
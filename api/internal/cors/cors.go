@@ -0,0 +1,93 @@
+// Package cors decides which browser origins may use the API, for REST calls
+// and WebSocket upgrades alike.
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	allowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	allowedHeaders = "Authorization, Content-Type"
+	// preflightMaxAge is how long browsers may cache a preflight answer
+	preflightMaxAge = 10 * 60
+)
+
+// Policy holds the allowed origins, normalized to lower-case scheme://host[:port]
+type Policy struct {
+	origins map[string]bool
+	any     bool
+}
+
+func NewPolicy(origins []string) *Policy {
+	p := &Policy{origins: make(map[string]bool, len(origins))}
+	for _, origin := range origins {
+		if origin == "*" {
+			p.any = true
+			continue
+		}
+		p.origins[strings.ToLower(origin)] = true
+	}
+	return p
+}
+
+// Allows reports whether origin is on the list
+func (p *Policy) Allows(origin string) bool {
+	return p.any || p.origins[strings.ToLower(origin)]
+}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin. Clients that are not browsers
+// send no Origin and are let through, as are pages served by the API itself.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return p.Allows(origin)
+}
+
+// Middleware adds CORS headers for allowed origins and answers their preflight
+// requests. Preflights from other origins are refused, other requests proceed
+// without headers so the browser withholds the response.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !p.Allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if p.any {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", allowedMethods)
+			c.Header("Access-Control-Allow-Headers", allowedHeaders)
+			c.Header("Access-Control-Max-Age", strconv.Itoa(preflightMaxAge))
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+// Decision outcomes
+const (
+	OutcomeReward       = "reward"
+	OutcomeAlert        = "alert"
+	OutcomeCooldownSkip = "cooldown_skip"
+	OutcomePendingSkip  = "pending_skip"
+	OutcomeBudgetSkip   = "budget_skip"
+	OutcomeFailure      = "failure"
+	OutcomeIncidentOpen = "incident_open"
+	OutcomeResolve      = "resolve"
+)
+
+// Analyzer run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerStartup  = "startup"
+	TriggerManual   = "manual"
+)
+
+// AnalyzerRun is one pass of the analyzer over all recorders (or a single one)
+type AnalyzerRun struct {
+	ID         uint `gorm:"primaryKey"`
+	DryRun     bool
+	Recorder   string `gorm:"collate:nocase"` // empty when all recorders were analyzed
+	Trigger    string
+	StartedAt  int64
+	FinishedAt int64
+}
+
+// Decision is what the analyzer decided (or would have decided) for a recorder in a run,
+// together with the data and policy that led to it
+type Decision struct {
+	ID           uint   `gorm:"primaryKey"`
+	RunID        uint   `gorm:"index"`
+	Recorder     string `gorm:"collate:nocase;index"`
+	DryRun       bool
+	WindowStart  int64
+	WindowEnd    int64
+	SampleCount  int64
+	AvgPH        float64
+	AvgTurbidity float64
+	Policy       string
+	Outcome      string
+	Reason       string
+	Error        string
+	TxHash       string
+	CreatedAt    int64 `gorm:"index"`
+}
+
+func StartAnalyzerRun(dryRun bool, recorder, trigger string, startedAt int64) (*AnalyzerRun, error) {
+	run := AnalyzerRun{DryRun: dryRun, Recorder: recorder, Trigger: trigger, StartedAt: startedAt}
+	if err := DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func FinishAnalyzerRun(run *AnalyzerRun, finishedAt int64) error {
+	run.FinishedAt = finishedAt
+	return DB.Model(run).Update("finished_at", finishedAt).Error
+}
+
+func RecordDecision(decision *Decision) error {
+	return DB.Create(decision).Error
+}
+
+// LatestAnalyzerRun returns the most recent run, optionally only among dry runs
+func LatestAnalyzerRun(dryRunOnly bool) (*AnalyzerRun, error) {
+	var run AnalyzerRun
+	query := DB.Order("id desc")
+	if dryRunOnly {
+		query = query.Where("dry_run = ?", true)
+	}
+	if err := query.First(&run).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func DecisionsForRun(runID uint) ([]Decision, error) {
+	var decisions []Decision
+	err := DB.Where("run_id = ?", runID).Order("id asc").Find(&decisions).Error
+	return decisions, err
+}
+
+// DecisionsForRecorder returns the decision history of a recorder, newest first
+func DecisionsForRecorder(recorder string, limit int) ([]Decision, error) {
+	var decisions []Decision
+	err := DB.Where("recorder = ?", recorder).Order("id desc").Limit(limit).Find(&decisions).Error
+	return decisions, err
+}
+
+// DecisionResponse is how the public and admin APIs show an analyzer decision
+type DecisionResponse struct {
+	RunID        uint    `json:"run_id"`
+	Recorder     string  `json:"recorder"`
+	DryRun       bool    `json:"dry_run"`
+	WindowStart  int64   `json:"window_start"`
+	WindowEnd    int64   `json:"window_end"`
+	SampleCount  int64   `json:"sample_count"`
+	AvgPH        float64 `json:"avg_ph"`
+	AvgTurbidity float64 `json:"avg_turbidity"`
+	Policy       string  `json:"policy"`
+	Outcome      string  `json:"outcome"`
+	Reason       string  `json:"reason"`
+	Error        string  `json:"error,omitempty"`
+	TxHash       string  `json:"tx_hash,omitempty"`
+	CreatedAt    int64   `json:"created_at"`
+}
+
+func NewDecisionResponses(decisions []Decision) []DecisionResponse {
+	response := []DecisionResponse{}
+	for _, d := range decisions {
+		response = append(response, DecisionResponse{
+			RunID:        d.RunID,
+			Recorder:     d.Recorder,
+			DryRun:       d.DryRun,
+			WindowStart:  d.WindowStart,
+			WindowEnd:    d.WindowEnd,
+			SampleCount:  d.SampleCount,
+			AvgPH:        d.AvgPH,
+			AvgTurbidity: d.AvgTurbidity,
+			Policy:       d.Policy,
+			Outcome:      d.Outcome,
+			Reason:       d.Reason,
+			Error:        d.Error,
+			TxHash:       d.TxHash,
+			CreatedAt:    d.CreatedAt,
+		})
+	}
+	return response
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Device statuses
+const (
+	DeviceOnline  = "online"
+	DeviceOffline = "offline"
+)
+
+// Device is the last status a recorder's daemon reported through its heartbeat
+type Device struct {
+	Recorder        string `gorm:"primaryKey;collate:nocase"`
+	Status          string `gorm:"index"`
+	Firmware        string
+	QueueDepth      int
+	LastPH          float64
+	LastTurbidity   float64
+	LastReadingAt   int64
+	UptimeSeconds   int64
+	LastHeartbeatAt int64 `gorm:"index"`
+	OfflineSince    int64
+	CreatedAt       int64
+	UpdatedAt       int64
+}
+
+// SaveHeartbeat stores a reported status and marks the device online.
+// It returns whether the device was offline before.
+func SaveHeartbeat(device *Device) (bool, error) {
+	wasOffline := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var previous []Device
+		if err := tx.Where("recorder = ?", device.Recorder).Limit(1).Find(&previous).Error; err != nil {
+			return err
+		}
+		wasOffline = len(previous) > 0 && previous[0].Status == DeviceOffline
+
+		device.Status = DeviceOnline
+		device.LastHeartbeatAt = time.Now().Unix()
+		device.OfflineSince = 0
+		return tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "recorder"}},
+			DoUpdates: clause.AssignmentColumns([]string{"status", "firmware", "queue_depth", "last_ph", "last_turbidity",
+				"last_reading_at", "uptime_seconds", "last_heartbeat_at", "offline_since", "updated_at"}),
+		}).Create(device).Error
+	})
+	return wasOffline, err
+}
+
+// MarkDevicesOffline flags online devices whose last heartbeat is older than the
+// given time and returns them
+func MarkDevicesOffline(silentSince time.Time) ([]Device, error) {
+	var stale []Device
+	if err := DB.Where("status = ? AND last_heartbeat_at < ?", DeviceOnline, silentSince.Unix()).Find(&stale).Error; err != nil {
+		return nil, err
+	}
+
+	var marked []Device
+	now := time.Now().Unix()
+	for _, device := range stale {
+		// A heartbeat may have arrived since the query
+		result := DB.Model(&Device{}).
+			Where("recorder = ? AND status = ? AND last_heartbeat_at < ?", device.Recorder, DeviceOnline, silentSince.Unix()).
+			Updates(map[string]interface{}{"status": DeviceOffline, "offline_since": now})
+		if result.Error != nil {
+			return marked, result.Error
+		}
+		if result.RowsAffected > 0 {
+			device.Status, device.OfflineSince = DeviceOffline, now
+			marked = append(marked, device)
+		}
+	}
+	return marked, nil
+}
+
+// ListDevices returns devices with the given status (all when empty), most recently seen first
+func ListDevices(status string) ([]Device, error) {
+	query := DB.Order("last_heartbeat_at desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	var devices []Device
+	err := query.Find(&devices).Error
+	return devices, err
+}
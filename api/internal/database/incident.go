@@ -0,0 +1,181 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Incident statuses
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+// Incident tracks a recorder that breached the quality policy from the first alert
+// until its readings recover. A recorder has at most one unresolved incident.
+type Incident struct {
+	ID             uint   `gorm:"primaryKey"`
+	Recorder       string `gorm:"collate:nocase;index"`
+	Status         string `gorm:"index"`
+	Severity       string
+	Reason         string
+	AvgPH          float64 // latest averages seen while the incident was active
+	AvgTurbidity   float64
+	OpenedAt       int64
+	LastSeenAt     int64
+	AcknowledgedAt int64
+	AcknowledgedBy string
+	EscalatedAt    int64
+	ResolvedAt     int64
+	CreatedAt      int64
+	UpdatedAt      int64
+}
+
+// IsActive reports whether the incident still needs attention
+func (i *Incident) IsActive() bool {
+	return i.Status == IncidentOpen || i.Status == IncidentAcknowledged
+}
+
+// ActiveIncident returns the unresolved incident of a recorder, or nil if there is none
+func ActiveIncident(recorder string) (*Incident, error) {
+	var incidents []Incident
+	err := DB.Where("recorder = ? AND status IN ?", recorder, []string{IncidentOpen, IncidentAcknowledged}).
+		Order("id desc").Limit(1).Find(&incidents).Error
+	if err != nil || len(incidents) == 0 {
+		return nil, err
+	}
+	return &incidents[0], nil
+}
+
+// OpenIncident creates an incident and enqueues the alerts announcing it in one
+// transaction, so a failure leaves neither behind and the next cycle starts over.
+// The alerts are built from the new incident since they refer to its ID.
+func OpenIncident(incident *Incident, alerts func(*Incident) ([]Notification, error), dedupWindow time.Duration) (int, error) {
+	enqueued := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+		incident.Status = IncidentOpen
+		incident.OpenedAt = now
+		incident.LastSeenAt = now
+		if err := tx.Create(incident).Error; err != nil {
+			return err
+		}
+		notifications, err := alerts(incident)
+		if err != nil {
+			return err
+		}
+		enqueued, err = enqueueNotifications(tx, notifications, dedupWindow)
+		return err
+	})
+	return enqueued, err
+}
+
+func GetIncident(id uint) (*Incident, error) {
+	var incident Incident
+	if err := DB.First(&incident, id).Error; err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
+
+// TouchIncident records that the breach is still ongoing
+func TouchIncident(incident *Incident, severity string, avgPH, avgTurbidity float64) error {
+	updates := map[string]interface{}{
+		"last_seen_at":  time.Now().Unix(),
+		"avg_ph":        avgPH,
+		"avg_turbidity": avgTurbidity,
+	}
+	if severity != incident.Severity {
+		updates["severity"] = severity
+	}
+	return DB.Model(incident).Updates(updates).Error
+}
+
+// AcknowledgeIncident marks an open incident as being handled. It reports false
+// when the incident does not exist or is not open.
+func AcknowledgeIncident(id uint, by string) (bool, error) {
+	result := DB.Model(&Incident{}).
+		Where("id = ? AND status = ?", id, IncidentOpen).
+		Updates(map[string]interface{}{
+			"status":          IncidentAcknowledged,
+			"acknowledged_at": time.Now().Unix(),
+			"acknowledged_by": by,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ResolveIncident closes an incident and enqueues its recovery notices in one transaction
+func ResolveIncident(incident *Incident, notices []Notification, dedupWindow time.Duration) (int, error) {
+	enqueued := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		resolvedAt := time.Now().Unix()
+		err := tx.Model(incident).Updates(map[string]interface{}{
+			"status":      IncidentResolved,
+			"resolved_at": resolvedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if enqueued, err = enqueueNotifications(tx, notices, dedupWindow); err != nil {
+			return err
+		}
+		incident.Status = IncidentResolved
+		incident.ResolvedAt = resolvedAt
+		return nil
+	})
+	return enqueued, err
+}
+
+// UnacknowledgedIncidents returns open incidents opened before the deadline that were not escalated yet
+func UnacknowledgedIncidents(openedBefore int64) ([]Incident, error) {
+	var incidents []Incident
+	err := DB.Where("status = ? AND escalated_at = 0 AND opened_at <= ?", IncidentOpen, openedBefore).
+		Order("id asc").Find(&incidents).Error
+	return incidents, err
+}
+
+// EscalateIncident marks an incident as escalated and enqueues the escalation notices in
+// one transaction. It reports false when the incident was acknowledged, resolved or
+// escalated in the meantime, so nobody is escalated to twice. A failure leaves the
+// incident unescalated for the next check to retry.
+func EscalateIncident(incident *Incident, notices []Notification, dedupWindow time.Duration) (bool, int, error) {
+	claimed, enqueued := false, 0
+	escalatedAt := time.Now().Unix()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Incident{}).
+			Where("id = ? AND status = ? AND escalated_at = 0", incident.ID, IncidentOpen).
+			Update("escalated_at", escalatedAt)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		var err error
+		if enqueued, err = enqueueNotifications(tx, notices, dedupWindow); err != nil {
+			return err
+		}
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+	if claimed {
+		incident.EscalatedAt = escalatedAt
+	}
+	return claimed, enqueued, nil
+}
+
+// ListIncidents returns incidents newest first, optionally filtered by status and recorder
+func ListIncidents(status, recorder string, limit int) ([]Incident, error) {
+	var incidents []Incident
+	query := DB.Order("id desc").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if recorder != "" {
+		query = query.Where("recorder = ?", recorder)
+	}
+	err := query.Find(&incidents).Error
+	return incidents, err
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification statuses
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationDead    = "dead"
+)
+
+// Notification is one message waiting in (or delivered from) the outbox
+type Notification struct {
+	ID            uint   `gorm:"primaryKey"`
+	Channel       string `gorm:"index"`
+	Recipient     string // empty means the channel's default recipient
+	Subject       string
+	Text          string
+	HTML          string
+	DedupKey      string `gorm:"index"`
+	Status        string `gorm:"index"`
+	Attempts      int
+	NextAttemptAt int64 `gorm:"index"`
+	LastError     string
+	SentAt        int64
+	CreatedAt     int64 `gorm:"index"`
+	UpdatedAt     int64
+}
+
+// NotificationAttempt records a single delivery try
+type NotificationAttempt struct {
+	ID             uint `gorm:"primaryKey"`
+	NotificationID uint `gorm:"index"`
+	Attempt        int
+	Succeeded      bool
+	Error          string
+	CreatedAt      int64
+}
+
+// EnqueueNotification adds a message to the outbox unless an identical one (same dedup key)
+// was enqueued within the window. It reports whether the message was enqueued.
+func EnqueueNotification(n *Notification, dedupWindow time.Duration) (bool, error) {
+	return enqueueNotification(DB, n, dedupWindow)
+}
+
+// EnqueueNotifications adds several messages in one transaction, so a failure leaves
+// none of them behind to be sent twice when the caller retries. It returns how many
+// were not duplicates.
+func EnqueueNotifications(notifications []Notification, dedupWindow time.Duration) (int, error) {
+	enqueued := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		enqueued, err = enqueueNotifications(tx, notifications, dedupWindow)
+		return err
+	})
+	return enqueued, err
+}
+
+func enqueueNotifications(tx *gorm.DB, notifications []Notification, dedupWindow time.Duration) (int, error) {
+	enqueued := 0
+	for i := range notifications {
+		ok, err := enqueueNotification(tx, &notifications[i], dedupWindow)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			enqueued++
+		}
+	}
+	return enqueued, nil
+}
+
+func enqueueNotification(tx *gorm.DB, n *Notification, dedupWindow time.Duration) (bool, error) {
+	var count int64
+	err := tx.Model(&Notification{}).
+		Where("dedup_key = ? AND status != ? AND created_at >= ?", n.DedupKey, NotificationDead, time.Now().Add(-dedupWindow).Unix()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	n.Status = NotificationPending
+	n.NextAttemptAt = time.Now().Unix()
+	return true, tx.Create(n).Error
+}
+
+// DueNotifications returns pending messages whose next attempt is due, oldest first
+func DueNotifications(now int64, limit int) ([]Notification, error) {
+	var notifications []Notification
+	err := DB.Where("status = ? AND next_attempt_at <= ?", NotificationPending, now).
+		Order("id asc").Limit(limit).Find(&notifications).Error
+	return notifications, err
+}
+
+// SaveNotificationAttempt stores the attempt and the updated state of its notification
+func SaveNotificationAttempt(n *Notification, attempt *NotificationAttempt) error {
+	if err := DB.Create(attempt).Error; err != nil {
+		return err
+	}
+	return DB.Model(n).Updates(map[string]interface{}{
+		"status":          n.Status,
+		"attempts":        n.Attempts,
+		"next_attempt_at": n.NextAttemptAt,
+		"last_error":      n.LastError,
+		"sent_at":         n.SentAt,
+	}).Error
+}
+
+func ListNotifications(status string, limit int) ([]Notification, error) {
+	var notifications []Notification
+	query := DB.Order("id desc").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&notifications).Error
+	return notifications, err
+}
+
+// RequeueNotification puts a dead notification back into the outbox for another round of attempts
+func RequeueNotification(id uint) (bool, error) {
+	result := DB.Model(&Notification{}).
+		Where("id = ? AND status = ?", id, NotificationDead).
+		Updates(map[string]interface{}{
+			"status":          NotificationPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().Unix(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,99 @@
+package database
+
+import "time"
+
+// Relay statuses, the same as those of rewards
+const (
+	RelayPending  = "pending"
+	RelayMined    = "mined"
+	RelayFailed   = "failed"
+	RelayReplaced = "replaced"
+)
+
+// Relay records a meta-transaction the API submitted on behalf of a recorder.
+// It backs the per-recorder rate limit and the nonce of requests still in flight.
+// Nonce is the recorder's forwarder nonce; the transaction paying for it is journaled
+// with its own nonce and fees before it is broadcast, and a rebroadcast adds a row.
+type Relay struct {
+	ID          uint   `gorm:"primaryKey"`
+	Recorder    string `gorm:"collate:nocase;index"`
+	Nonce       uint64 `gorm:"index"`
+	Method      string
+	Readings    int
+	Gas         uint64 // requested by the recorder for the inner call
+	Forwarder   string
+	TxHash      string `gorm:"index"`
+	TxNonce     uint64
+	GasLimit    uint64 // of the transaction the operator pays for
+	GasFeeCap   string // in wei
+	GasTipCap   string // in wei
+	Calldata    string // hex encoded forwarder call, for rebroadcasts
+	Status      string `gorm:"index"`
+	BlockNumber uint64
+	GasUsed     uint64
+	CreatedAt   int64 `gorm:"index"`
+	UpdatedAt   int64
+}
+
+// SaveRelay stores a signed relay transaction as pending before it is broadcast
+func SaveRelay(relay *Relay) error {
+	relay.Status = RelayPending
+	return DB.Create(relay).Error
+}
+
+// DeleteRelay forgets a relay whose transaction the node rejected
+func DeleteRelay(id uint) error {
+	return DB.Delete(&Relay{}, id).Error
+}
+
+// PendingRelays returns all relays waiting for a receipt, oldest first
+func PendingRelays() ([]Relay, error) {
+	var relays []Relay
+	err := DB.Where("status = ?", RelayPending).Order("tx_nonce asc").Find(&relays).Error
+	return relays, err
+}
+
+// UpdateRelayStatus records the outcome of a relay transaction
+func UpdateRelayStatus(id uint, status string, blockNumber, gasUsed uint64) error {
+	return DB.Model(&Relay{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       status,
+		"block_number": blockNumber,
+		"gas_used":     gasUsed,
+	}).Error
+}
+
+// CountRelays returns how many requests of a recorder were relayed since the given time.
+// Rebroadcasts of a request do not count again.
+func CountRelays(recorder string, since time.Time) (int64, error) {
+	var count int64
+	err := DB.Model(&Relay{}).Where("LOWER(recorder) = LOWER(?) AND created_at >= ?", recorder, since.Unix()).
+		Distinct("nonce").Count(&count).Error
+	return count, err
+}
+
+// RelayedGasSince sums the gas the operator paid or may still pay for relays since the
+// given time: the gas used by settled transactions and the gas limit of pending ones
+func RelayedGasSince(since time.Time) (uint64, error) {
+	var total uint64
+	err := DB.Model(&Relay{}).
+		Where("created_at >= ? AND status != ?", since.Unix(), RelayReplaced).
+		Select("COALESCE(SUM(CASE WHEN status = ? THEN gas_limit ELSE gas_used END), 0)", RelayPending).
+		Scan(&total).Error
+	return total, err
+}
+
+// LatestRelay returns the most recent relayed request of a recorder, or nil if there is none
+func LatestRelay(recorder string) (*Relay, error) {
+	var relays []Relay
+	if err := DB.Where("LOWER(recorder) = LOWER(?)", recorder).Order("id desc").Limit(1).Find(&relays).Error; err != nil || len(relays) == 0 {
+		return nil, err
+	}
+	return &relays[0], nil
+}
+
+// RelaysByNonce returns the transactions sent for one request of a recorder, oldest first
+func RelaysByNonce(recorder string, nonce uint64) ([]Relay, error) {
+	var relays []Relay
+	err := DB.Where("LOWER(recorder) = LOWER(?) AND nonce = ?", recorder, nonce).Order("id asc").Find(&relays).Error
+	return relays, err
+}
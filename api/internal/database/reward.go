@@ -0,0 +1,109 @@
+package database
+
+import (
+	"log"
+	"math/big"
+)
+
+// Reward statuses
+const (
+	RewardPending  = "pending"
+	RewardMined    = "mined"
+	RewardFailed   = "failed"
+	RewardReplaced = "replaced"
+)
+
+type Reward struct {
+	ID          uint   `gorm:"primaryKey"`
+	Recorder    string `gorm:"collate:nocase;index"`
+	Amount      string // in wei
+	TxHash      string `gorm:"uniqueIndex"`
+	Nonce       uint64
+	Status      string `gorm:"index"`
+	BlockNumber uint64
+	GasUsed     uint64
+	CreatedAt   int64
+	UpdatedAt   int64
+}
+
+// RecordReward stores a signed reward transaction as pending before it is broadcast
+func RecordReward(recorder, amount, txHash string, nonce uint64) (*Reward, error) {
+	reward := Reward{
+		Recorder: recorder,
+		Amount:   amount,
+		TxHash:   txHash,
+		Nonce:    nonce,
+		Status:   RewardPending,
+	}
+	if err := DB.Create(&reward).Error; err != nil {
+		log.Printf("DB: Error recording reward: %v", err)
+		return nil, err
+	}
+	return &reward, nil
+}
+
+// DeleteReward forgets a reward whose transaction the node rejected
+func DeleteReward(id uint) error {
+	return DB.Delete(&Reward{}, id).Error
+}
+
+// HasPendingReward reports whether a recorder still has an unconfirmed payout
+func HasPendingReward(recorder string) bool {
+	var count int64
+	DB.Model(&Reward{}).
+		Where("recorder = ? AND status = ?", recorder, RewardPending).
+		Count(&count)
+	return count > 0
+}
+
+// PendingRewards returns all rewards waiting for a receipt, oldest first
+func PendingRewards() ([]Reward, error) {
+	var rewards []Reward
+	err := DB.Where("status = ?", RewardPending).Order("nonce asc").Find(&rewards).Error
+	return rewards, err
+}
+
+// UpdateRewardStatus records the outcome of a reward transaction
+func UpdateRewardStatus(id uint, status string, blockNumber, gasUsed uint64) error {
+	return DB.Model(&Reward{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       status,
+		"block_number": blockNumber,
+		"gas_used":     gasUsed,
+	}).Error
+}
+
+// RewardsForRecorder returns the payout history of a recorder, newest first
+func RewardsForRecorder(recorder string) ([]Reward, error) {
+	var rewards []Reward
+	err := DB.Where("recorder = ?", recorder).Order("created_at desc").Find(&rewards).Error
+	return rewards, err
+}
+
+// RewardTotalSince sums the amounts of live (pending or mined) rewards created after since.
+// An empty recorder sums over all recorders. Replaced and failed transactions paid nothing,
+// and rebroadcasts share their nonce with the original so they are only counted once.
+func RewardTotalSince(recorder string, since int64) (*big.Int, error) {
+	query := DB.Model(&Reward{}).
+		Where("created_at >= ? AND status IN ?", since, []string{RewardPending, RewardMined})
+	if recorder != "" {
+		query = query.Where("recorder = ?", recorder)
+	}
+
+	var rewards []Reward
+	if err := query.Select("nonce", "amount").Find(&rewards).Error; err != nil {
+		return nil, err
+	}
+
+	byNonce := make(map[uint64]string)
+	for _, r := range rewards {
+		byNonce[r.Nonce] = r.Amount
+	}
+
+	total := new(big.Int)
+	for _, amount := range byNonce {
+		if v, ok := new(big.Int).SetString(amount, 10); ok {
+			total.Add(total, v)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAlreadyRotated is returned when a recorder key was already handed over to another key
+var ErrAlreadyRotated = errors.New("recorder key was already rotated")
+
+// KeyRotation records a recorder handing its registration over to a new key
+type KeyRotation struct {
+	ID          uint   `gorm:"primaryKey"`
+	FromAddress string `gorm:"collate:nocase;uniqueIndex"`
+	ToAddress   string `gorm:"collate:nocase;index"`
+	SignedAt    int64
+	Signature   string
+	CreatedAt   int64
+}
+
+// RotateRecorder moves the location, subscriptions and device status of a recorder to
+// its new address and records the handover. A key can only be rotated away once;
+// repeating the same handover succeeds without changes so clients can retry it.
+func RotateRecorder(rotation *KeyRotation) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing []KeyRotation
+		if err := tx.Where("LOWER(from_address) = LOWER(?)", rotation.FromAddress).Limit(1).Find(&existing).Error; err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			if strings.EqualFold(existing[0].ToAddress, rotation.ToAddress) {
+				*rotation = existing[0]
+				return nil
+			}
+			return ErrAlreadyRotated
+		}
+
+		from, to := rotation.FromAddress, rotation.ToAddress
+		var recorders []Recorder
+		if err := tx.Where("LOWER(address) = LOWER(?)", from).Limit(1).Find(&recorders).Error; err != nil {
+			return err
+		}
+		if len(recorders) > 0 {
+			moved := Recorder{Address: to, Lat: recorders[0].Lat, Lon: recorders[0].Lon}
+			if err := tx.Where("LOWER(address) = LOWER(?)", to).Delete(&Recorder{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&moved).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&recorders[0]).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&Subscription{}).Where("LOWER(recorder) = LOWER(?)", from).Update("recorder", to).Error; err != nil {
+			return err
+		}
+		// The new key reports its own status from its first heartbeat on
+		if err := tx.Where("LOWER(recorder) = LOWER(?)", from).Delete(&Device{}).Error; err != nil {
+			return err
+		}
+
+		rotation.CreatedAt = time.Now().Unix()
+		return tx.Create(rotation).Error
+	})
+}
@@ -62,12 +62,50 @@ func InitDB(filepath string) {
 	}
 
 	// Auto Migrate
-	err = DB.AutoMigrate(&Recorder{}, &Log{}, &ProcessedRecorder{}, &User{}, &Session{})
+	err = DB.AutoMigrate(&Recorder{}, &Log{}, &ProcessedRecorder{}, &User{}, &Session{}, &Reward{}, &AnalyzerRun{}, &Decision{}, &Subscription{}, &Notification{}, &NotificationAttempt{}, &Incident{}, &Relay{}, &Device{}, &KeyRotation{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 }
 
+// Close releases the database once nothing writes to it anymore
+func Close() {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		log.Printf("Failed to get database handle: %v", err)
+		return
+	}
+	if err := sqlDB.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+}
+
+// IsRegisteredRecorder reports whether an operator registered the recorder address
+func IsRegisteredRecorder(address string) (bool, error) {
+	var count int64
+	err := DB.Model(&Recorder{}).Where("LOWER(address) = LOWER(?)", address).Count(&count).Error
+	return count > 0, err
+}
+
+// RegisterRecorder adds a recorder or updates its location
+func RegisterRecorder(address string, lat, lon float64) error {
+	var recorders []Recorder
+	if err := DB.Where("LOWER(address) = LOWER(?)", address).Limit(1).Find(&recorders).Error; err != nil {
+		return err
+	}
+	if len(recorders) > 0 {
+		return DB.Model(&recorders[0]).Updates(map[string]interface{}{"lat": lat, "lon": lon}).Error
+	}
+	return DB.Create(&Recorder{Address: address, Lat: lat, Lon: lon}).Error
+}
+
+// ListRecorders returns every registered recorder
+func ListRecorders() ([]Recorder, error) {
+	var recorders []Recorder
+	err := DB.Order("address").Find(&recorders).Error
+	return recorders, err
+}
+
 // Helper to get recorder location
 func GetRecorderLocation(address string) (float64, float64) {
 	var recorder Recorder
@@ -108,3 +146,12 @@ func (s *Store) StoreSession(publicKey, token string, expiry time.Time) {
 		log.Printf("DB: Session stored for key starting with '%s...' (Expires: %s)", publicKey[:20], expiry.Format(time.Kitchen))
 	}
 }
+
+// ActiveSession returns the unexpired session issued with the given token
+func (s *Store) ActiveSession(token string, now time.Time) (*Session, error) {
+	var session Session
+	if err := s.DB.Where("token = ? AND expiry > ?", token, now.Unix()).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
@@ -0,0 +1,54 @@
+package database
+
+// Subscription routes alerts to one recipient over one channel. It is scoped to a
+// single recorder, to a bounding box, or (when neither is set) to every recorder.
+type Subscription struct {
+	ID          uint   `gorm:"primaryKey"`
+	Recipient   string // email address, chat ID or webhook URL, depending on the channel
+	Channel     string
+	Recorder    string `gorm:"collate:nocase;index"`
+	MinLat      *float64
+	MinLon      *float64
+	MaxLat      *float64
+	MaxLon      *float64
+	MinSeverity string
+	Language    string // template language, empty for the server default
+	Token       string `gorm:"uniqueIndex"` // secret used in unsubscribe links
+	CreatedAt   int64
+}
+
+// HasBoundingBox reports whether the subscription is scoped to a region
+func (s *Subscription) HasBoundingBox() bool {
+	return s.MinLat != nil && s.MinLon != nil && s.MaxLat != nil && s.MaxLon != nil
+}
+
+func CreateSubscription(sub *Subscription) error {
+	return DB.Create(sub).Error
+}
+
+func ListSubscriptions() ([]Subscription, error) {
+	var subs []Subscription
+	err := DB.Order("id asc").Find(&subs).Error
+	return subs, err
+}
+
+func DeleteSubscription(id uint) (bool, error) {
+	result := DB.Delete(&Subscription{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+func DeleteSubscriptionByToken(token string) (bool, error) {
+	result := DB.Where("token = ?", token).Delete(&Subscription{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SubscriptionsFor returns the subscriptions interested in a recorder at the given location.
+// Severity filtering is left to the caller.
+func SubscriptionsFor(recorder string, lat, lon float64) ([]Subscription, error) {
+	var subs []Subscription
+	err := DB.Where("recorder = ?", recorder).
+		Or("(recorder = '' OR recorder IS NULL) AND min_lat IS NULL").
+		Or("min_lat <= ? AND max_lat >= ? AND min_lon <= ? AND max_lon >= ?", lat, lat, lon, lon).
+		Find(&subs).Error
+	return subs, err
+}
@@ -0,0 +1,101 @@
+package devices
+
+import (
+	"log"
+	"net/http"
+
+	"p2m-lite/internal/auth"
+	"p2m-lite/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Reading struct {
+	PH        float64 `json:"ph"`
+	Turbidity float64 `json:"turbidity"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+type HeartbeatRequest struct {
+	Firmware      string   `json:"firmware"`
+	QueueDepth    int      `json:"queue_depth"`
+	UptimeSeconds int64    `json:"uptime_seconds"`
+	LastReading   *Reading `json:"last_reading"`
+}
+
+// Heartbeat records the status a daemon reports and keeps its recorder online
+func Heartbeat(c *gin.Context) {
+	var req HeartbeatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid heartbeat payload: " + err.Error()})
+		return
+	}
+
+	device := &database.Device{
+		Recorder:      auth.Recorder(c).Hex(),
+		Firmware:      req.Firmware,
+		QueueDepth:    req.QueueDepth,
+		UptimeSeconds: req.UptimeSeconds,
+	}
+	if req.LastReading != nil {
+		device.LastPH = req.LastReading.PH
+		device.LastTurbidity = req.LastReading.Turbidity
+		device.LastReadingAt = req.LastReading.Timestamp
+	}
+
+	wasOffline, err := database.SaveHeartbeat(device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record heartbeat"})
+		return
+	}
+	if wasOffline {
+		log.Printf("Devices: %s is back online", device.Recorder)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": device.Status})
+}
+
+type DeviceResponse struct {
+	Recorder        string  `json:"recorder"`
+	Status          string  `json:"status"`
+	Firmware        string  `json:"firmware"`
+	QueueDepth      int     `json:"queue_depth"`
+	LastPH          float64 `json:"last_ph"`
+	LastTurbidity   float64 `json:"last_turbidity"`
+	LastReadingAt   int64   `json:"last_reading_at,omitempty"`
+	UptimeSeconds   int64   `json:"uptime_seconds"`
+	LastHeartbeatAt int64   `json:"last_heartbeat_at"`
+	OfflineSince    int64   `json:"offline_since,omitempty"`
+}
+
+// ListDevices returns the reported status of every recorder, optionally filtered by ?status=online|offline
+func ListDevices(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && status != database.DeviceOnline && status != database.DeviceOffline {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be online or offline"})
+		return
+	}
+
+	devices, err := database.ListDevices(status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch devices"})
+		return
+	}
+
+	response := make([]DeviceResponse, 0, len(devices))
+	for _, d := range devices {
+		response = append(response, DeviceResponse{
+			Recorder:        d.Recorder,
+			Status:          d.Status,
+			Firmware:        d.Firmware,
+			QueueDepth:      d.QueueDepth,
+			LastPH:          d.LastPH,
+			LastTurbidity:   d.LastTurbidity,
+			LastReadingAt:   d.LastReadingAt,
+			UptimeSeconds:   d.UptimeSeconds,
+			LastHeartbeatAt: d.LastHeartbeatAt,
+			OfflineSince:    d.OfflineSince,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": response})
+}
@@ -0,0 +1,94 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"p2m-lite/internal/auth"
+	"p2m-lite/internal/database"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gin-gonic/gin"
+)
+
+// HandoverMessage is the text the old key signs (EIP-191) to hand its recorder over to a new key
+func HandoverMessage(from, to common.Address, signedAt int64) string {
+	return fmt.Sprintf("P2M key rotation\nRecorder: %s\nNew key: %s\nSigned at: %d", from.Hex(), to.Hex(), signedAt)
+}
+
+type RotateRequest struct {
+	From      string        `json:"from" binding:"required"`
+	SignedAt  int64         `json:"signed_at" binding:"required"`
+	Signature hexutil.Bytes `json:"signature" binding:"required"`
+}
+
+// RotateKey carries a recorder's registration over to the key of the current session.
+// The old key proves it agrees by signing the handover message.
+func RotateKey(c *gin.Context) {
+	var req RotateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rotation payload: " + err.Error()})
+		return
+	}
+	if !common.IsHexAddress(req.From) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recorder address"})
+		return
+	}
+	from, to := common.HexToAddress(req.From), auth.Recorder(c)
+	if from == to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The new key must differ from the old one"})
+		return
+	}
+	if age := time.Since(time.Unix(req.SignedAt, 0)); age > vals.KeyRotationMaxAge || age < -vals.KeyRotationMaxAge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Handover signature is too old or from the future"})
+		return
+	}
+
+	signer, err := recoverSigner(HandoverMessage(from, to, req.SignedAt), req.Signature)
+	if err != nil || signer != from {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Handover is not signed by the old key"})
+		return
+	}
+
+	err = database.RotateRecorder(&database.KeyRotation{
+		FromAddress: from.Hex(),
+		ToAddress:   to.Hex(),
+		SignedAt:    req.SignedAt,
+		Signature:   hexutil.Encode(req.Signature),
+	})
+	if errors.Is(err, database.ErrAlreadyRotated) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate recorder key"})
+		return
+	}
+
+	log.Printf("Devices: Recorder %s rotated its key to %s", from.Hex(), to.Hex())
+	c.JSON(http.StatusOK, gin.H{"recorder": to.Hex(), "previous": from.Hex()})
+}
+
+// recoverSigner returns the account that personal-signed message (v = 27/28)
+func recoverSigner(message string, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, errors.New("signature must be 65 bytes")
+	}
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	publicKey, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
@@ -0,0 +1,16 @@
+package devices
+
+import (
+	"p2m-lite/internal/auth"
+	"p2m-lite/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupRoutes(r *gin.Engine, db *database.Store) {
+	r.GET("/api/devices", ListDevices)
+	// Daemons report their status with the session token from /auth/verify
+	r.POST("/api/devices/heartbeat", auth.RequireSession(db), Heartbeat)
+	// Called with the session of the new key, signed by the old one
+	r.POST("/api/devices/rotate", auth.RequireSession(db), RotateKey)
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const DefaultBrevoURL = "https://api.brevo.com/v3/smtp/email"
+
+type brevoContact struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+type brevoPayload struct {
+	Sender      brevoContact   `json:"sender"`
+	To          []brevoContact `json:"to"`
+	Subject     string         `json:"subject"`
+	HtmlContent string         `json:"htmlContent,omitempty"`
+	TextContent string         `json:"textContent,omitempty"`
+}
+
+// Brevo sends transactional email through the Brevo HTTP API
+type Brevo struct {
+	url       string
+	apiKey    string
+	sender    brevoContact
+	defaultTo string
+}
+
+func NewBrevo(url, apiKey, senderName, senderEmail, defaultTo string) *Brevo {
+	if url == "" {
+		url = DefaultBrevoURL
+	}
+	return &Brevo{
+		url:       url,
+		apiKey:    apiKey,
+		sender:    brevoContact{Name: senderName, Email: senderEmail},
+		defaultTo: defaultTo,
+	}
+}
+
+func (b *Brevo) Name() string { return "brevo" }
+
+func (b *Brevo) Send(ctx context.Context, recipient string, msg Message) error {
+	if recipient == "" {
+		recipient = b.defaultTo
+	}
+	if recipient == "" {
+		return ErrNoRecipient
+	}
+
+	payload := brevoPayload{
+		Sender:      b.sender,
+		To:          []brevoContact{{Email: recipient}},
+		Subject:     msg.Subject,
+		HtmlContent: msg.HTML,
+		TextContent: msg.Text,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", b.url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("api-key", b.apiKey)
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("failed to send email, status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
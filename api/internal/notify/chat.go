@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Chat webhook flavors
+const (
+	ChatSlack   = "slack"
+	ChatDiscord = "discord"
+)
+
+// ChatWebhook posts to Slack or Discord incoming webhooks (and anything compatible with them)
+type ChatWebhook struct {
+	flavor string
+	url    string
+}
+
+func NewChatWebhook(flavor, url string) *ChatWebhook {
+	return &ChatWebhook{flavor: flavor, url: url}
+}
+
+func (w *ChatWebhook) Name() string { return w.flavor }
+
+// Send posts to the webhook. A recipient, if given, is a different webhook URL.
+func (w *ChatWebhook) Send(ctx context.Context, recipient string, msg Message) error {
+	target := w.url
+	if recipient != "" {
+		// Subscriptions stored before recipients were validated may still name any URL
+		if err := ValidateRecipient(w.flavor, recipient); err != nil {
+			return err
+		}
+		target = recipient
+	}
+
+	text := fmt.Sprintf("*%s*\n%s", msg.Subject, msg.Text)
+	var payload any = map[string]string{"text": text}
+	if w.flavor == ChatDiscord {
+		payload = map[string]string{"content": fmt.Sprintf("**%s**\n%s", msg.Subject, msg.Text)}
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s webhook returned status code: %d", w.flavor, resp.StatusCode)
+	}
+	return nil
+}
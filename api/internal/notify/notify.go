@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"p2m-lite/config"
+)
+
+// Message is a rendered notification with a plain-text and an optional HTML body
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Notifier delivers messages over one channel (email, chat, webhook, ...)
+type Notifier interface {
+	Name() string
+	// Send delivers msg to recipient. An empty recipient means the channel's configured default.
+	Send(ctx context.Context, recipient string, msg Message) error
+}
+
+var (
+	ErrNoRecipient    = errors.New("no recipient given and no default configured")
+	ErrUnknownChannel = errors.New("notification channel is not enabled")
+)
+
+// httpClient is shared by all HTTP based channels so a slow provider cannot block forever
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Dispatcher fans a message out to every configured channel
+type Dispatcher struct {
+	channels []Notifier
+}
+
+func NewDispatcher(channels ...Notifier) *Dispatcher {
+	return &Dispatcher{channels: channels}
+}
+
+func (d *Dispatcher) Channels() []Notifier {
+	return d.channels
+}
+
+// Channel looks up a configured channel by name, returning nil if it is not enabled
+func (d *Dispatcher) Channel(name string) Notifier {
+	for _, ch := range d.channels {
+		if ch.Name() == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Broadcast sends msg to the default recipient of every channel. It succeeds if at
+// least one channel delivered the message; failures of the others are logged.
+func (d *Dispatcher) Broadcast(ctx context.Context, msg Message) error {
+	if len(d.channels) == 0 {
+		return errors.New("no notification channels configured")
+	}
+
+	var errs []error
+	for _, ch := range d.channels {
+		if err := ch.Send(ctx, "", msg); err != nil {
+			log.Printf("Notify: %s failed: %v", ch.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+		}
+	}
+	if len(errs) == len(d.channels) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// FromConfig builds every channel that has its settings present in the config
+func FromConfig(cfg *config.Config) (*Dispatcher, error) {
+	var channels []Notifier
+
+	if cfg.BrevoAPIKey != "" {
+		channels = append(channels, NewBrevo(cfg.BrevoAPIURL, cfg.BrevoAPIKey, cfg.SenderName, cfg.SenderEmail, cfg.AlertEmail))
+	}
+	if cfg.SMTPURL != "" {
+		smtp, err := NewSMTP(cfg.SMTPURL, cfg.SenderName, cfg.SenderEmail, cfg.AlertEmail)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, smtp)
+	}
+	if cfg.SlackWebhookURL != "" {
+		channels = append(channels, NewChatWebhook(ChatSlack, cfg.SlackWebhookURL))
+	}
+	if cfg.DiscordWebhookURL != "" {
+		channels = append(channels, NewChatWebhook(ChatDiscord, cfg.DiscordWebhookURL))
+	}
+	if cfg.WebhookURL != "" {
+		channels = append(channels, NewWebhook(cfg.WebhookURL, cfg.WebhookSecret))
+	}
+	if cfg.TelegramBotToken != "" {
+		channels = append(channels, NewTelegram(cfg.TelegramAPIURL, cfg.TelegramBotToken, cfg.TelegramChatID))
+	}
+
+	for _, ch := range channels {
+		log.Printf("Notify: Channel %s enabled", ch.Name())
+	}
+	return NewDispatcher(channels...), nil
+}
+
+// Hosts a Slack or Discord subscription may name as its webhook instead of the configured one
+var chatHosts = map[string][]string{
+	ChatSlack:   {"hooks.slack.com"},
+	ChatDiscord: {"discord.com", "discordapp.com"},
+}
+
+// ValidateRecipient checks a subscription recipient before it reaches a channel. Email
+// channels need a bare address and chat channels an https webhook URL on the service's
+// own host, so a subscription cannot make the API post to internal endpoints. No
+// recipient may span lines, which would let it inject mail headers or request lines.
+func ValidateRecipient(channel, recipient string) error {
+	if strings.ContainsAny(recipient, "\r\n") {
+		return errors.New("recipient must not contain line breaks")
+	}
+	if recipient == "" {
+		return nil
+	}
+	switch channel {
+	case "smtp", "brevo":
+		addr, err := mail.ParseAddress(recipient)
+		if err != nil || addr.Address != recipient {
+			return fmt.Errorf("invalid email address %q", recipient)
+		}
+	case ChatSlack, ChatDiscord:
+		u, err := url.Parse(recipient)
+		if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+			return fmt.Errorf("%s recipient must be an https webhook URL", channel)
+		}
+		if !slices.Contains(chatHosts[channel], strings.ToLower(u.Hostname())) {
+			return fmt.Errorf("%s recipient must be a webhook on %s", channel, strings.Join(chatHosts[channel], " or "))
+		}
+	}
+	return nil
+}
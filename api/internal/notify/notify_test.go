@@ -0,0 +1,34 @@
+package notify
+
+import "testing"
+
+func TestValidateRecipient(t *testing.T) {
+	tests := []struct {
+		channel   string
+		recipient string
+		wantErr   bool
+	}{
+		{"smtp", "ops@example.com", false},
+		{"brevo", "Ops <ops@example.com>", true},
+		{"smtp", "ops@example.com\r\nBcc: x@example.com", true},
+		{ChatSlack, "", false},
+		{ChatSlack, "https://hooks.slack.com/services/T000/B000/XXXX", false},
+		{ChatSlack, "http://hooks.slack.com/services/T000/B000/XXXX", true},
+		{ChatSlack, "https://hooks.slack.com:8443/services/T000", true},
+		{ChatSlack, "https://user@hooks.slack.com/services/T000", true},
+		{ChatSlack, "https://169.254.169.254/latest/meta-data", true},
+		{ChatSlack, "https://discord.com/api/webhooks/1/abc", true},
+		{ChatDiscord, "https://discord.com/api/webhooks/1/abc", false},
+		{ChatDiscord, "https://Discordapp.com/api/webhooks/1/abc", false},
+		{ChatDiscord, "https://discord.com.example.org/api/webhooks/1/abc", true},
+		{ChatDiscord, "/api/webhooks/1/abc", true},
+		{"telegram", "-1001234567890", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel+" "+tt.recipient, func(t *testing.T) {
+			if err := ValidateRecipient(tt.channel, tt.recipient); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRecipient(%q, %q) error = %v, wantErr %v", tt.channel, tt.recipient, err, tt.wantErr)
+			}
+		})
+	}
+}
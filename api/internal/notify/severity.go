@@ -0,0 +1,27 @@
+package notify
+
+// Alert severities, from least to most urgent
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo:     0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+}
+
+func ValidSeverity(severity string) bool {
+	_, ok := severityRank[severity]
+	return ok
+}
+
+// AtLeast reports whether severity is as urgent as min. An empty min accepts everything.
+func AtLeast(severity, min string) bool {
+	if min == "" {
+		return true
+	}
+	return severityRank[severity] >= severityRank[min]
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const DefaultTelegramURL = "https://api.telegram.org"
+
+// Telegram sends messages through the Telegram Bot API
+type Telegram struct {
+	apiURL        string
+	token         string
+	defaultChatID string
+}
+
+func NewTelegram(apiURL, token, defaultChatID string) *Telegram {
+	if apiURL == "" {
+		apiURL = DefaultTelegramURL
+	}
+	return &Telegram{
+		apiURL:        strings.TrimSuffix(apiURL, "/"),
+		token:         token,
+		defaultChatID: defaultChatID,
+	}
+}
+
+func (t *Telegram) Name() string { return "telegram" }
+
+// Send delivers to a chat ID. The recipient, if given, overrides the default chat.
+func (t *Telegram) Send(ctx context.Context, recipient string, msg Message) error {
+	chatID := recipient
+	if chatID == "" {
+		chatID = t.defaultChatID
+	}
+	if chatID == "" {
+		return ErrNoRecipient
+	}
+
+	jsonData, err := json.Marshal(map[string]string{
+		"chat_id": chatID,
+		"text":    msg.Subject + "\n\n" + msg.Text,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", t.apiURL, t.token)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return redactURL(err)
+	}
+	req.Header.Set("content-type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return redactURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("telegram returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// redactURL drops the request URL, which carries the bot token, from an error so it
+// does not end up in logs or the outbox
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("telegram request failed: %w", urlErr.Err)
+	}
+	return err
+}
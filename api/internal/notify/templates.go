@@ -0,0 +1,162 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLanguage is used when a recipient has no language or no template exists for it
+const DefaultLanguage = "en"
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Templates renders named messages in several languages. Every message <name> in
+// language <lang> consists of <lang>/<name>.txt.tmpl, which must define a "subject"
+// block, and an optional <lang>/<name>.html.tmpl.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// LoadTemplates parses the embedded default templates. Files in dir, laid out the
+// same way, replace the defaults of the same name or add new languages.
+func LoadTemplates(dir string) (*Templates, error) {
+	sources := make(map[string]string)
+	defaults, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if err := collectTemplates(defaults, sources); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := collectTemplates(os.DirFS(dir), sources); err != nil {
+			return nil, fmt.Errorf("failed to load templates from %s: %w", dir, err)
+		}
+	}
+
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for file, src := range sources {
+		key, isHTML := strings.CutSuffix(file, ".html.tmpl")
+		if !isHTML {
+			key = strings.TrimSuffix(file, ".txt.tmpl")
+		}
+
+		if isHTML {
+			tmpl, err := htmltemplate.New(file).Parse(src)
+			if err != nil {
+				return nil, err
+			}
+			t.html[key] = tmpl
+			continue
+		}
+		tmpl, err := texttemplate.New(file).Parse(src)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.Lookup("subject") == nil {
+			return nil, fmt.Errorf("template %s does not define a subject", file)
+		}
+		t.text[key] = tmpl
+	}
+
+	for key := range t.html {
+		if _, ok := t.text[key]; !ok {
+			return nil, fmt.Errorf("template %s.html.tmpl has no matching %s.txt.tmpl", key, key)
+		}
+	}
+	return t, nil
+}
+
+func collectTemplates(fsys fs.FS, sources map[string]string) error {
+	return fs.WalkDir(fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !strings.HasSuffix(file, ".txt.tmpl") && !strings.HasSuffix(file, ".html.tmpl") {
+			return nil
+		}
+		if strings.Count(file, "/") != 1 {
+			return fmt.Errorf("template %s must live in a language directory such as en/", file)
+		}
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		sources[file] = string(data)
+		return nil
+	})
+}
+
+// Languages lists every language that has at least one template
+func (t *Templates) Languages() []string {
+	seen := make(map[string]bool)
+	for key := range t.text {
+		seen[path.Dir(key)] = true
+	}
+	langs := make([]string, 0, len(seen))
+	for lang := range seen {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// HasLanguage reports whether any template exists in lang
+func (t *Templates) HasLanguage(lang string) bool {
+	for _, l := range t.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes message name in lang, falling back to the default language
+func (t *Templates) Render(name, lang string, data any) (Message, error) {
+	if lang == "" {
+		lang = DefaultLanguage
+	}
+	key := lang + "/" + name
+	text, ok := t.text[key]
+	if !ok {
+		key = DefaultLanguage + "/" + name
+		if text, ok = t.text[key]; !ok {
+			return Message{}, fmt.Errorf("no template named %q", name)
+		}
+	}
+
+	var msg Message
+	var buf bytes.Buffer
+	if err := text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("failed to render subject of %s: %w", key, err)
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := text.Execute(&buf, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render %s: %w", key, err)
+	}
+	msg.Text = strings.TrimSpace(buf.String())
+
+	if html, ok := t.html[key]; ok {
+		buf.Reset()
+		if err := html.Execute(&buf, data); err != nil {
+			return Message{}, fmt.Errorf("failed to render %s.html.tmpl: %w", key, err)
+		}
+		msg.HTML = buf.String()
+	}
+	return msg, nil
+}
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook posts the message as JSON to an arbitrary endpoint. When a secret is set, each request
+// carries X-P2M-Timestamp and X-P2M-Signature: sha256=HMAC(secret, timestamp + "." + body).
+type Webhook struct {
+	url    string
+	secret string
+}
+
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{url: url, secret: secret}
+}
+
+func (w *Webhook) Name() string { return "webhook" }
+
+type webhookPayload struct {
+	Recipient string `json:"recipient,omitempty"`
+	Subject   string `json:"subject"`
+	Text      string `json:"text"`
+	HTML      string `json:"html,omitempty"`
+	SentAt    int64  `json:"sent_at"`
+}
+
+func (w *Webhook) Send(ctx context.Context, recipient string, msg Message) error {
+	now := time.Now().Unix()
+	body, err := json.Marshal(webhookPayload{
+		Recipient: recipient,
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		SentAt:    now,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+	if w.secret != "" {
+		timestamp := strconv.FormatInt(now, 10)
+		req.Header.Set("X-P2M-Timestamp", timestamp)
+		req.Header.Set("X-P2M-Signature", "sha256="+Sign(w.secret, timestamp, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign computes the hex HMAC receivers use to verify a webhook delivery
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,205 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"p2m-lite/config"
+	"p2m-lite/internal/database"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+var (
+	ErrBreakerOpen    = errors.New("payouts are halted by the circuit breaker")
+	ErrCycleBudget    = errors.New("payout budget for this cycle is exhausted")
+	ErrRecorderBudget = errors.New("recorder has reached its payout budget for the period")
+)
+
+// budget holds the configured payout limits in wei. Nil limits are not enforced.
+type budget struct {
+	perCycle       *big.Int
+	perDay         *big.Int
+	perRecorder    *big.Int
+	recorderPeriod time.Duration
+	cycleGas       uint64
+	relayGas       uint64
+	minBalance     *big.Int
+}
+
+func newBudget(cfg *config.Config) budget {
+	return budget{
+		perCycle:       cfg.PayoutCycleBudget,
+		perDay:         cfg.PayoutDailyBudget,
+		perRecorder:    cfg.PayoutRecorderBudget,
+		recorderPeriod: time.Duration(cfg.PayoutRecorderPeriodDays) * 24 * time.Hour,
+		cycleGas:       cfg.CycleGasBudget,
+		relayGas:       cfg.RelayDailyGasBudget,
+		minBalance:     cfg.MinTreasuryBalance,
+	}
+}
+
+// Breaker halts all payouts once tripped, until an operator resets it
+type Breaker struct {
+	mu     sync.Mutex
+	reason string
+	since  time.Time
+	onTrip func(reason string)
+}
+
+// Trip opens the breaker. Operators are only notified on the first trip, in the
+// background so a slow notification never holds up the payout or relay that tripped it.
+func (b *Breaker) Trip(reason string) {
+	b.mu.Lock()
+	if b.reason != "" {
+		b.mu.Unlock()
+		return
+	}
+	b.reason = reason
+	b.since = time.Now()
+	onTrip := b.onTrip
+	b.mu.Unlock()
+
+	log.Printf("Payout: Circuit breaker tripped: %s", reason)
+	if onTrip != nil {
+		go onTrip(reason)
+	}
+}
+
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reason != "" {
+		log.Printf("Payout: Circuit breaker reset (was: %s)", b.reason)
+	}
+	b.reason = ""
+	b.since = time.Time{}
+}
+
+// State reports whether the breaker is open, why and since when
+func (b *Breaker) State() (open bool, reason string, since time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reason != "", b.reason, b.since
+}
+
+// Cycle tracks what one analyzer run has paid out so far
+type Cycle struct {
+	s     *Service
+	spent *big.Int
+	gas   uint64
+}
+
+func (s *Service) NewCycle() *Cycle {
+	return &Cycle{s: s, spent: new(big.Int)}
+}
+
+// Pay sends a reward after checking every budget and the treasury balance
+func (c *Cycle) Pay(ctx context.Context, to common.Address, value *big.Int) (*types.Transaction, error) {
+	if err := c.authorize(ctx, to, value); err != nil {
+		return nil, err
+	}
+
+	tx, err := c.s.Send(ctx, to, value)
+	if err != nil {
+		return nil, err
+	}
+	c.spent.Add(c.spent, value)
+	c.gas += tx.Gas()
+	return tx, nil
+}
+
+func (c *Cycle) authorize(ctx context.Context, to common.Address, value *big.Int) error {
+	b := c.s.budget
+	if open, _, _ := c.s.breaker.State(); open {
+		return ErrBreakerOpen
+	}
+
+	if b.cycleGas > 0 && c.gas >= b.cycleGas {
+		return ErrCycleBudget
+	}
+	if b.perCycle != nil && new(big.Int).Add(c.spent, value).Cmp(b.perCycle) > 0 {
+		return ErrCycleBudget
+	}
+
+	if b.perDay != nil {
+		paid, err := database.RewardTotalSince("", time.Now().Add(-24*time.Hour).Unix())
+		if err != nil {
+			return fmt.Errorf("failed to sum daily payouts: %w", err)
+		}
+		if paid.Add(paid, value).Cmp(b.perDay) > 0 {
+			c.s.breaker.Trip(fmt.Sprintf("daily payout budget of %s BNB reached", formatBNB(b.perDay)))
+			return ErrBreakerOpen
+		}
+	}
+
+	if b.perRecorder != nil {
+		paid, err := database.RewardTotalSince(to.Hex(), time.Now().Add(-b.recorderPeriod).Unix())
+		if err != nil {
+			return fmt.Errorf("failed to sum recorder payouts: %w", err)
+		}
+		if paid.Add(paid, value).Cmp(b.perRecorder) > 0 {
+			return ErrRecorderBudget
+		}
+	}
+
+	balance, err := c.s.node.BalanceAt(ctx, c.s.from, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch treasury balance: %w", err)
+	}
+	cost, err := c.s.maxCost(ctx, to, value)
+	if err != nil {
+		return err
+	}
+	remaining := new(big.Int).Sub(balance, cost)
+	if remaining.Sign() < 0 || (b.minBalance != nil && remaining.Cmp(b.minBalance) < 0) {
+		c.s.breaker.Trip(fmt.Sprintf("treasury %s is low: balance %s BNB", c.s.from.Hex(), formatBNB(balance)))
+		return ErrBreakerOpen
+	}
+	return nil
+}
+
+// AuthorizeRelay checks that a relayed call requesting gas fits the daily relay gas
+// budget. Exceeding it trips the breaker, which halts relaying and payouts alike.
+func (s *Service) AuthorizeRelay(gas uint64) error {
+	if open, _, _ := s.breaker.State(); open {
+		return ErrBreakerOpen
+	}
+	if s.budget.relayGas == 0 {
+		return nil
+	}
+	used, err := database.RelayedGasSince(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to sum relayed gas: %w", err)
+	}
+	if used+gas > s.budget.relayGas {
+		s.breaker.Trip(fmt.Sprintf("daily relay gas budget of %d reached", s.budget.relayGas))
+		return ErrBreakerOpen
+	}
+	return nil
+}
+
+// maxCost is the most a transfer can take from the treasury: its value plus the gas
+// limit at the highest fee it would be sent with
+func (s *Service) maxCost(ctx context.Context, to common.Address, value *big.Int) (*big.Int, error) {
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := s.estimateGas(ctx, to, value, nil)
+	if err != nil {
+		return nil, err
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas), fees.feeCap)
+	return fee.Add(fee, value), nil
+}
+
+func formatBNB(wei *big.Int) string {
+	return new(big.Rat).SetFrac(wei, big.NewInt(1_000_000_000_000_000_000)).FloatString(6)
+}
@@ -0,0 +1,155 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var other = common.HexToAddress("0x2222222222222222222222222222222222222222")
+
+func rewards(n int64) *big.Int {
+	return big.NewInt(n * vals.RewardAmount)
+}
+
+func TestCycleAuthorize(t *testing.T) {
+	// Each payout costs the reward plus 21000 gas at a 21 gwei fee cap
+	cost := new(big.Int).Add(rewards(1), big.NewInt(21000*21*gwei))
+
+	tests := []struct {
+		name        string
+		budget      budget
+		balance     *big.Int
+		paidBefore  int64 // rewards already paid to recorder today
+		pays        []common.Address
+		wantErr     error // of the last payout, all before it succeed
+		wantTripped bool
+	}{
+		{"within every budget", budget{perCycle: rewards(3), perDay: rewards(3), perRecorder: rewards(3), recorderPeriod: 24 * time.Hour},
+			nil, 0, []common.Address{recorder, other, recorder}, nil, false},
+		{"cycle budget", budget{perCycle: rewards(2)}, nil, 0, []common.Address{recorder, other, other}, ErrCycleBudget, false},
+		{"cycle gas budget", budget{cycleGas: 42000}, nil, 0, []common.Address{recorder, other, other}, ErrCycleBudget, false},
+		{"daily budget trips the breaker", budget{perDay: rewards(3)}, nil, 2, []common.Address{other, other}, ErrBreakerOpen, true},
+		{"recorder budget", budget{perRecorder: rewards(2), recorderPeriod: 24 * time.Hour}, nil, 1, []common.Address{other, recorder, recorder}, ErrRecorderBudget, false},
+		{"empty treasury trips the breaker", budget{}, new(big.Int).Sub(cost, big.NewInt(1)), 0, []common.Address{recorder}, ErrBreakerOpen, true},
+		{"minimum balance trips the breaker", budget{minBalance: big.NewInt(1e15)}, new(big.Int).Add(cost, big.NewInt(1e15-1)), 0, []common.Address{recorder}, ErrBreakerOpen, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode()
+			if tt.balance != nil {
+				node.balance = tt.balance
+			}
+			s := newTestService(t, node, tt.budget)
+			for i := range tt.paidBefore {
+				if _, err := database.RecordReward(recorder.Hex(), rewards(1).String(), common.Hash{byte(i + 1)}.Hex(), uint64(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cycle := s.NewCycle()
+			for i, to := range tt.pays {
+				_, err := cycle.Pay(context.Background(), to, rewards(1))
+				if i < len(tt.pays)-1 {
+					if err != nil {
+						t.Fatalf("payout %d failed: %v", i+1, err)
+					}
+					continue
+				}
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("last payout error = %v, want %v", err, tt.wantErr)
+				}
+			}
+			if open, reason, _ := s.Breaker().State(); open != tt.wantTripped {
+				t.Errorf("breaker open = %v (%s), want %v", open, reason, tt.wantTripped)
+			}
+			if want := len(tt.pays) - 1; tt.wantErr != nil && len(node.sent) != want {
+				t.Errorf("%d payouts sent, want %d", len(node.sent), want)
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	s := newTestService(t, newFakeNode(), budget{})
+	trips := make(chan string, 2)
+	s.OnTrip(func(reason string) { trips <- reason })
+
+	s.Breaker().Trip("first")
+	s.Breaker().Trip("second")
+	select {
+	case reason := <-trips:
+		if reason != "first" {
+			t.Errorf("operators notified of %q, want the first trip", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("operators were not notified of the trip")
+	}
+
+	if _, err := s.NewCycle().Pay(context.Background(), recorder, rewards(1)); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("Pay() with the breaker open error = %v, want %v", err, ErrBreakerOpen)
+	}
+	if err := s.AuthorizeRelay(21000); !errors.Is(err, ErrBreakerOpen) {
+		t.Errorf("AuthorizeRelay() with the breaker open error = %v, want %v", err, ErrBreakerOpen)
+	}
+
+	s.Breaker().Reset()
+	if _, err := s.NewCycle().Pay(context.Background(), recorder, rewards(1)); err != nil {
+		t.Errorf("Pay() after a reset failed: %v", err)
+	}
+	s.Breaker().Trip("third")
+	select {
+	case reason := <-trips:
+		if reason != "third" {
+			t.Errorf("operators notified of %q, want the trip after the reset", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("operators were not notified of the trip after the reset")
+	}
+}
+
+func TestAuthorizeRelay(t *testing.T) {
+	tests := []struct {
+		name        string
+		relays      []database.Relay
+		gas         uint64
+		wantTripped bool
+	}{
+		{"no relays yet", nil, 100_000, false},
+		{"pending relays count their gas limit", []database.Relay{{GasLimit: 400_000}}, 200_000, true},
+		{"settled relays count the gas they used", []database.Relay{{GasLimit: 400_000, GasUsed: 150_000, Status: database.RelayMined}}, 200_000, false},
+		{"replaced relays paid nothing", []database.Relay{{GasLimit: 400_000, Status: database.RelayReplaced}}, 200_000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t, newFakeNode(), budget{relayGas: 500_000})
+			for i, relay := range tt.relays {
+				relay.Recorder, relay.Nonce = recorder.Hex(), uint64(i)
+				status := relay.Status
+				if err := database.SaveRelay(&relay); err != nil {
+					t.Fatal(err)
+				}
+				if status != "" {
+					if err := database.UpdateRelayStatus(relay.ID, status, 1, relay.GasUsed); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			err := s.AuthorizeRelay(tt.gas)
+			if tripped := errors.Is(err, ErrBreakerOpen); tripped != tt.wantTripped || (err != nil && !tripped) {
+				t.Errorf("AuthorizeRelay(%d) error = %v, want tripped %v", tt.gas, err, tt.wantTripped)
+			}
+			if open, _, _ := s.Breaker().State(); open != tt.wantTripped {
+				t.Errorf("breaker open = %v, want %v", open, tt.wantTripped)
+			}
+		})
+	}
+}
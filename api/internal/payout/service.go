@@ -0,0 +1,446 @@
+package payout
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"sync"
+
+	"p2m-lite/config"
+	"p2m-lite/internal/database"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// backend is the part of the RPC client payouts rely on
+type backend interface {
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// Service owns the payer key and a single RPC client. All payouts go through it
+// so that nonces are allocated locally and sends never race each other.
+type Service struct {
+	client  *ethclient.Client
+	node    backend // the same client, tests replace it with a fake node
+	key     *ecdsa.PrivateKey
+	from    common.Address
+	chainID *big.Int
+
+	maxFeePerGas *big.Int
+	maxTipPerGas *big.Int
+	gasMargin    int
+
+	budget  budget
+	breaker Breaker
+
+	mu        sync.Mutex
+	nonce     uint64
+	nonceSync bool
+}
+
+func NewService(cfg *config.Config) (*Service, error) {
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(cfg.PrivateKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid payer private key: %w", err)
+	}
+
+	client, err := ethclient.Dial(cfg.BlockchainURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to blockchain: %w", err)
+	}
+
+	chainID, err := client.NetworkID(context.Background())
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to fetch chain id: %w", err)
+	}
+
+	return &Service{
+		client:  client,
+		node:    client,
+		key:     privateKey,
+		from:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		chainID: chainID,
+
+		maxFeePerGas: cfg.MaxFeePerGas,
+		maxTipPerGas: cfg.MaxTipPerGas,
+		gasMargin:    cfg.GasLimitMargin,
+
+		budget: newBudget(cfg),
+	}, nil
+}
+
+// Address returns the payer account
+func (s *Service) Address() common.Address {
+	return s.from
+}
+
+// ChainID returns the id of the chain the payer sends to
+func (s *Service) ChainID() *big.Int {
+	return new(big.Int).Set(s.chainID)
+}
+
+// Client exposes the shared RPC client for read-only calls
+func (s *Service) Client() *ethclient.Client {
+	return s.client
+}
+
+// Breaker exposes the payout circuit breaker
+func (s *Service) Breaker() *Breaker {
+	return &s.breaker
+}
+
+// OnTrip registers a callback that notifies operators when payouts are halted
+func (s *Service) OnTrip(fn func(reason string)) {
+	s.breaker.mu.Lock()
+	defer s.breaker.mu.Unlock()
+	s.breaker.onTrip = fn
+}
+
+func (s *Service) Close() {
+	s.client.Close()
+}
+
+// journal persists a signed transaction before it is broadcast and returns how to
+// forget it again should the node reject it
+type journal func(tx *types.Transaction) (discard func(), err error)
+
+// rewardJournal records payouts as pending rewards before they leave the API, so
+// the confirmer tracks every transfer that may reach the chain
+func rewardJournal(tx *types.Transaction) (func(), error) {
+	reward, err := database.RecordReward(tx.To().Hex(), tx.Value().String(), tx.Hash().Hex(), tx.Nonce())
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := database.DeleteReward(reward.ID); err != nil {
+			log.Printf("Payout: Failed to drop rejected reward %s: %v", reward.TxHash, err)
+		}
+	}, nil
+}
+
+// relayJournal records forwarder calls as pending relays, with everything needed to
+// rebroadcast them
+func relayJournal(relay database.Relay) journal {
+	return func(tx *types.Transaction) (func(), error) {
+		record := relay
+		record.ID = 0
+		record.Forwarder = tx.To().Hex()
+		record.TxHash = tx.Hash().Hex()
+		record.TxNonce = tx.Nonce()
+		record.GasLimit = tx.Gas()
+		record.GasFeeCap = tx.GasFeeCap().String()
+		record.GasTipCap = tx.GasTipCap().String()
+		record.Calldata = hexutil.Encode(tx.Data())
+		if err := database.SaveRelay(&record); err != nil {
+			return nil, err
+		}
+		return func() {
+			if err := database.DeleteRelay(record.ID); err != nil {
+				log.Printf("Payout: Failed to drop rejected relay %s: %v", record.TxHash, err)
+			}
+		}, nil
+	}
+}
+
+// Send transfers value to the given address using the next local nonce. The
+// transfer is recorded as a pending reward before it is broadcast.
+func (s *Service) Send(ctx context.Context, to common.Address, value *big.Int) (*types.Transaction, error) {
+	return s.transact(ctx, to, value, nil, rewardJournal)
+}
+
+// Relay sends a forwarder call from the payer account, sharing the nonce sequence
+// with payouts. The call is checked against the relay gas budget and recorded as a
+// pending relay of the recorder before it is broadcast, so the confirmer tracks it.
+func (s *Service) Relay(ctx context.Context, forwarder common.Address, data []byte, relay database.Relay) (*types.Transaction, error) {
+	gas, err := s.estimateGas(ctx, forwarder, new(big.Int), data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.AuthorizeRelay(gas); err != nil {
+		return nil, err
+	}
+	return s.transact(ctx, forwarder, new(big.Int), data, relayJournal(relay))
+}
+
+func (s *Service) transact(ctx context.Context, to common.Address, value *big.Int, data []byte, record journal) (*types.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lastErr error
+	for attempt := 0; attempt < vals.PayoutSendAttempts; attempt++ {
+		if err := s.syncNonce(ctx); err != nil {
+			return nil, err
+		}
+
+		fees, err := s.suggestFees(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		gas, err := s.estimateGas(ctx, to, value, data)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := s.sign(s.nonce, to, value, data, gas, fees)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.broadcast(ctx, tx, record); err == nil {
+			s.nonce++
+			return tx, nil
+		}
+
+		// Whatever happened, the node is the source of truth for the next attempt
+		s.nonceSync = false
+		lastErr = err
+		if !isNonceConflict(err) {
+			return nil, err
+		}
+		// Someone else (or a previous run) used this nonce. Re-read it from the node and retry.
+		log.Printf("Payout: Nonce %d rejected (%v). Resyncing...", s.nonce, err)
+	}
+	return nil, fmt.Errorf("payout failed after %d attempts: %w", vals.PayoutSendAttempts, lastErr)
+}
+
+// Resend rebroadcasts a stuck transfer with the same nonce and bumped fees, recording
+// the replacement as a pending reward first
+func (s *Service) Resend(ctx context.Context, previous common.Hash, nonce uint64, to common.Address, value *big.Int) (*types.Transaction, error) {
+	return s.resend(ctx, previous, nonce, nil, to, value, nil, rewardJournal)
+}
+
+// ResendRelay rebroadcasts a stuck relay transaction with the same nonce and bumped
+// fees, recording the replacement as another pending relay of the same request
+func (s *Service) ResendRelay(ctx context.Context, relay database.Relay) (*types.Transaction, error) {
+	data, err := hexutil.Decode(relay.Calldata)
+	if err != nil {
+		return nil, fmt.Errorf("relay %s has invalid calldata: %w", relay.TxHash, err)
+	}
+	tip, tipOK := new(big.Int).SetString(relay.GasTipCap, 10)
+	feeCap, feeOK := new(big.Int).SetString(relay.GasFeeCap, 10)
+	if !tipOK || !feeOK {
+		return nil, fmt.Errorf("relay %s has invalid fees", relay.TxHash)
+	}
+	forwarder := common.HexToAddress(relay.Forwarder)
+	journaled := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   s.chainID,
+		Nonce:     relay.TxNonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       relay.GasLimit,
+		To:        &forwarder,
+		Data:      data,
+	})
+	return s.resend(ctx, common.HexToHash(relay.TxHash), relay.TxNonce, journaled, forwarder, new(big.Int), data, relayJournal(relay))
+}
+
+// resend signs a replacement with the nonce of previous that outbids it. The node's
+// copy of previous is used when it has one, otherwise journaled (if given) stands
+// in for it, so a transaction other nodes may still hold is outbid all the same.
+func (s *Service) resend(ctx context.Context, previous common.Hash, nonce uint64, journaled *types.Transaction, to common.Address, value *big.Int, data []byte, record journal) (*types.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fees, err := s.suggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prevTx := journaled
+	if known, _, err := s.node.TransactionByHash(ctx, previous); err == nil {
+		prevTx = known
+	}
+	gas := uint64(0)
+	if prevTx != nil {
+		gas = prevTx.Gas()
+		if data == nil {
+			data = prevTx.Data()
+		}
+		bumpedTip, bumpedFee := bumpFee(prevTx.GasTipCap()), bumpFee(prevTx.GasFeeCap())
+		if bumpedTip.Cmp(fees.tip) > 0 {
+			fees.tip = bumpedTip
+		}
+		if bumpedFee.Cmp(fees.feeCap) > 0 {
+			fees.feeCap = bumpedFee
+		}
+		if exceeds(fees.tip, s.maxTipPerGas) || exceeds(fees.feeCap, s.maxFeePerGas) {
+			return nil, fmt.Errorf("bumped fees for nonce %d exceed the configured caps", nonce)
+		}
+	}
+	if gas == 0 {
+		if gas, err = s.estimateGas(ctx, to, value, data); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.sign(nonce, to, value, data, gas, fees)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.broadcast(ctx, tx, record); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+type feeSuggestion struct {
+	tip    *big.Int
+	feeCap *big.Int
+}
+
+// suggestFees follows the usual wallet heuristic (2 * baseFee + tip) and clamps it to the configured caps
+func (s *Service) suggestFees(ctx context.Context) (*feeSuggestion, error) {
+	tip, err := s.node.SuggestGasTipCap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest gas tip: %w", err)
+	}
+	head, err := s.node.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch latest header: %w", err)
+	}
+	if head.BaseFee == nil {
+		return nil, errors.New("chain does not support EIP-1559 dynamic fees")
+	}
+	if s.maxFeePerGas != nil && head.BaseFee.Cmp(s.maxFeePerGas) > 0 {
+		return nil, fmt.Errorf("base fee %s wei is above the configured max fee %s wei", head.BaseFee, s.maxFeePerGas)
+	}
+
+	if exceeds(tip, s.maxTipPerGas) {
+		tip = new(big.Int).Set(s.maxTipPerGas)
+	}
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	if exceeds(feeCap, s.maxFeePerGas) {
+		feeCap = new(big.Int).Set(s.maxFeePerGas)
+	}
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return &feeSuggestion{tip: tip, feeCap: feeCap}, nil
+}
+
+// estimateGas asks the node for a gas limit and adds the configured safety margin.
+// Contract wallets need more than the 21000 of a plain transfer.
+func (s *Service) estimateGas(ctx context.Context, to common.Address, value *big.Int, data []byte) (uint64, error) {
+	gas, err := s.node.EstimateGas(ctx, ethereum.CallMsg{
+		From:  s.from,
+		To:    &to,
+		Value: value,
+		Data:  data,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+	gas += gas * uint64(s.gasMargin) / 100
+	if gas < vals.TransferGasLimit {
+		gas = vals.TransferGasLimit
+	}
+	return gas, nil
+}
+
+func (s *Service) sign(nonce uint64, to common.Address, value *big.Int, data []byte, gas uint64, fees *feeSuggestion) (*types.Transaction, error) {
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   s.chainID,
+		Nonce:     nonce,
+		GasTipCap: fees.tip,
+		GasFeeCap: fees.feeCap,
+		Gas:       gas,
+		To:        &to,
+		Value:     value,
+		Data:      data,
+	})
+	return types.SignTx(tx, types.LatestSignerForChainID(s.chainID), s.key)
+}
+
+// broadcast records tx with record, when set, and sends it. Only an error the node
+// answered with proves the transaction was rejected, and only then is the record
+// discarded. After a timeout or a dropped connection the node may hold it, so it
+// counts as sent and the confirmer settles (or rebroadcasts) it later.
+func (s *Service) broadcast(ctx context.Context, tx *types.Transaction, record journal) error {
+	discard := func() {}
+	if record != nil {
+		var err error
+		if discard, err = record(tx); err != nil {
+			return fmt.Errorf("failed to record transaction before sending: %w", err)
+		}
+	}
+
+	err := s.node.SendTransaction(ctx, tx)
+	if err == nil {
+		return nil
+	}
+	if isAlreadyKnown(err) {
+		// The node holds this very transaction already, e.g. from an earlier broadcast
+		return nil
+	}
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		log.Printf("Payout: Broadcast of %s (nonce %d) has an unknown outcome, tracking it as sent: %v", tx.Hash().Hex(), tx.Nonce(), err)
+		return nil
+	}
+	discard()
+	return err
+}
+
+func (s *Service) syncNonce(ctx context.Context) error {
+	if s.nonceSync {
+		return nil
+	}
+	nonce, err := s.node.PendingNonceAt(ctx, s.from)
+	if err != nil {
+		return fmt.Errorf("failed to fetch pending nonce: %w", err)
+	}
+	s.nonce = nonce
+	s.nonceSync = true
+	return nil
+}
+
+// bumpFee raises a fee by vals.FeeBumpPercent, which nodes require for replacements
+func bumpFee(fee *big.Int) *big.Int {
+	bumped := new(big.Int).Mul(fee, big.NewInt(100+vals.FeeBumpPercent))
+	bumped.Div(bumped, big.NewInt(100))
+	return bumped.Add(bumped, big.NewInt(1))
+}
+
+func exceeds(fee, limit *big.Int) bool {
+	return limit != nil && fee.Cmp(limit) > 0
+}
+
+var nonceErrors = []string{
+	"nonce too low",
+	"replacement transaction underpriced",
+}
+
+// isAlreadyKnown reports that the node already has the transaction in its pool
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+// Errors come back over JSON-RPC as plain strings, so match on the message
+func isNonceConflict(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, e := range nonceErrors {
+		if strings.Contains(msg, e) {
+			return true
+		}
+	}
+	return false
+}
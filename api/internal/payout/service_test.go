@@ -0,0 +1,290 @@
+package payout
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const gwei = 1_000_000_000
+
+var recorder = common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+// rpcError is an error the node answered with, as opposed to a transport failure
+type rpcError string
+
+func (e rpcError) Error() string  { return string(e) }
+func (e rpcError) ErrorCode() int { return -32000 }
+
+// fakeNode answers like an RPC node with fixed fees and gas estimates
+type fakeNode struct {
+	mu       sync.Mutex
+	baseFee  *big.Int
+	tip      *big.Int
+	gas      uint64
+	balance  *big.Int
+	nonces   []uint64 // pending nonce of each lookup, the last one repeats
+	sendErrs []error  // result of each send, nil once used up
+	sent     []*types.Transaction
+	known    map[common.Hash]*types.Transaction
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{
+		baseFee: big.NewInt(10 * gwei),
+		tip:     big.NewInt(1 * gwei),
+		gas:     21000,
+		balance: big.NewInt(1e18),
+		nonces:  []uint64{5},
+		known:   make(map[common.Hash]*types.Transaction),
+	}
+}
+
+func (n *fakeNode) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).Set(n.tip), nil
+}
+
+func (n *fakeNode) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{BaseFee: new(big.Int).Set(n.baseFee)}, nil
+}
+
+func (n *fakeNode) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return n.gas, nil
+}
+
+func (n *fakeNode) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, tx)
+	if len(n.sendErrs) > 0 {
+		err := n.sendErrs[0]
+		n.sendErrs = n.sendErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	n.known[tx.Hash()] = tx
+	return nil
+}
+
+func (n *fakeNode) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	nonce := n.nonces[0]
+	if len(n.nonces) > 1 {
+		n.nonces = n.nonces[1:]
+	}
+	return nonce, nil
+}
+
+func (n *fakeNode) TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if tx, ok := n.known[hash]; ok {
+		return tx, true, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
+func (n *fakeNode) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return new(big.Int).Set(n.balance), nil
+}
+
+// newTestService returns a payer on a fake node and a fresh database
+func newTestService(t *testing.T, node *fakeNode, b budget) *Service {
+	t.Helper()
+	database.InitDB(filepath.Join(t.TempDir(), "payout.db"))
+	t.Cleanup(database.Close)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Service{
+		node:         node,
+		key:          key,
+		from:         crypto.PubkeyToAddress(key.PublicKey),
+		chainID:      big.NewInt(97),
+		maxFeePerGas: big.NewInt(100 * gwei),
+		maxTipPerGas: big.NewInt(5 * gwei),
+		budget:       b,
+	}
+}
+
+func pendingRewards(t *testing.T) []database.Reward {
+	t.Helper()
+	rewards, err := database.PendingRewards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rewards
+}
+
+func TestSend(t *testing.T) {
+	nonceTooLow := rpcError("nonce too low")
+	tests := []struct {
+		name       string
+		nonces     []uint64
+		sendErrs   []error
+		wantErr    bool
+		wantNonces []uint64 // of every broadcast
+		wantNext   uint64   // local nonce afterwards
+	}{
+		{"sent", []uint64{5}, nil, false, []uint64{5}, 6},
+		{"nonce too low resyncs", []uint64{5, 7}, []error{nonceTooLow}, false, []uint64{5, 7}, 8},
+		{"underpriced replacement resyncs", []uint64{5, 6}, []error{rpcError("replacement transaction underpriced")}, false, []uint64{5, 6}, 7},
+		{"already known counts as sent", []uint64{5}, []error{rpcError("already known")}, false, []uint64{5}, 6},
+		{"unknown outcome counts as sent", []uint64{5}, []error{errors.New("connection reset by peer")}, false, []uint64{5}, 6},
+		{"rejection is not retried", []uint64{5}, []error{rpcError("insufficient funds for gas * price + value")}, true, []uint64{5}, 5},
+		{"gives up after the last attempt", []uint64{5, 6, 7}, []error{nonceTooLow, nonceTooLow, nonceTooLow}, true, []uint64{5, 6, 7}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode()
+			node.nonces, node.sendErrs = tt.nonces, tt.sendErrs
+			s := newTestService(t, node, budget{})
+
+			tx, err := s.Send(context.Background(), recorder, big.NewInt(vals.RewardAmount))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var nonces []uint64
+			for _, sent := range node.sent {
+				nonces = append(nonces, sent.Nonce())
+			}
+			if !slices.Equal(nonces, tt.wantNonces) {
+				t.Errorf("broadcast nonces = %v, want %v", nonces, tt.wantNonces)
+			}
+			if s.nonceSync && s.nonce != tt.wantNext {
+				t.Errorf("next nonce = %d, want %d", s.nonce, tt.wantNext)
+			}
+
+			// Only what may have reached the chain stays journaled
+			rewards := pendingRewards(t)
+			if tt.wantErr {
+				if len(rewards) != 0 {
+					t.Errorf("%d rewards journaled for a rejected payout", len(rewards))
+				}
+				return
+			}
+			if len(rewards) != 1 || rewards[0].TxHash != tx.Hash().Hex() || rewards[0].Nonce != tx.Nonce() {
+				t.Errorf("journaled rewards = %+v, want only %s", rewards, tx.Hash().Hex())
+			}
+		})
+	}
+}
+
+func TestResend(t *testing.T) {
+	tests := []struct {
+		name       string
+		prevTip    int64 // in gwei, 0 means the node forgot the transaction
+		prevFeeCap int64
+		nodeTip    int64
+		wantTip    *big.Int
+		wantFeeCap *big.Int
+		wantErr    bool
+	}{
+		// The node suggests a 1 gwei tip and a 21 gwei fee cap
+		{"bumps the previous fees", 2, 30, 1, bumpFee(big.NewInt(2 * gwei)), bumpFee(big.NewInt(30 * gwei)), false},
+		{"keeps higher suggested fees", 1, 15, 4, big.NewInt(4 * gwei), big.NewInt(24 * gwei), false},
+		{"uses suggested fees for a forgotten transaction", 0, 0, 1, big.NewInt(1 * gwei), big.NewInt(21 * gwei), false},
+		{"refuses to exceed the tip cap", 5, 30, 1, nil, nil, true},
+		{"refuses to exceed the fee cap", 2, 90, 1, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newFakeNode()
+			node.tip = big.NewInt(tt.nodeTip * gwei)
+			s := newTestService(t, node, budget{})
+
+			previous := common.Hash{1}
+			if tt.prevTip > 0 {
+				prev, err := s.sign(3, recorder, big.NewInt(vals.RewardAmount), nil, 30000, &feeSuggestion{
+					tip:    big.NewInt(tt.prevTip * gwei),
+					feeCap: big.NewInt(tt.prevFeeCap * gwei),
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				previous = prev.Hash()
+				node.known[previous] = prev
+			}
+
+			tx, err := s.Resend(context.Background(), previous, 3, recorder, big.NewInt(vals.RewardAmount))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(node.sent) != 0 {
+					t.Errorf("%d transactions sent although the caps forbid it", len(node.sent))
+				}
+				return
+			}
+			if tx.Nonce() != 3 {
+				t.Errorf("nonce = %d, want the nonce of the stuck transaction", tx.Nonce())
+			}
+			if tx.GasTipCap().Cmp(tt.wantTip) != 0 || tx.GasFeeCap().Cmp(tt.wantFeeCap) != 0 {
+				t.Errorf("fees = %s/%s, want %s/%s", tx.GasTipCap(), tx.GasFeeCap(), tt.wantTip, tt.wantFeeCap)
+			}
+			if rewards := pendingRewards(t); len(rewards) != 1 || rewards[0].TxHash != tx.Hash().Hex() {
+				t.Errorf("journaled rewards = %+v, want the replacement", rewards)
+			}
+		})
+	}
+}
+
+// A relay the node forgot is outbid by its journaled fees, other nodes may still hold it
+func TestResendRelayForgotten(t *testing.T) {
+	node := newFakeNode()
+	s := newTestService(t, node, budget{})
+
+	forwarder := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	stuck := database.Relay{
+		Recorder:  recorder.Hex(),
+		Nonce:     2,
+		Method:    "storeLogs",
+		Forwarder: forwarder.Hex(),
+		TxHash:    common.Hash{2}.Hex(),
+		TxNonce:   4,
+		GasLimit:  200000,
+		GasFeeCap: big.NewInt(40 * gwei).String(),
+		GasTipCap: big.NewInt(3 * gwei).String(),
+		Calldata:  hexutil.Encode([]byte{0xde, 0xad, 0xbe, 0xef}),
+	}
+	if err := database.SaveRelay(&stuck); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := s.ResendRelay(context.Background(), stuck)
+	if err != nil {
+		t.Fatalf("ResendRelay() error = %v", err)
+	}
+	if tx.Nonce() != 4 || *tx.To() != forwarder || tx.Gas() != 200000 || hexutil.Encode(tx.Data()) != stuck.Calldata {
+		t.Errorf("replacement = nonce %d to %s gas %d data %x, want the stuck call", tx.Nonce(), tx.To().Hex(), tx.Gas(), tx.Data())
+	}
+	if tx.GasTipCap().Cmp(bumpFee(big.NewInt(3*gwei))) != 0 || tx.GasFeeCap().Cmp(bumpFee(big.NewInt(40*gwei))) != 0 {
+		t.Errorf("fees = %s/%s, want the journaled fees bumped", tx.GasTipCap(), tx.GasFeeCap())
+	}
+
+	relays, err := database.RelaysByNonce(recorder.Hex(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(relays) != 2 || relays[1].TxHash != tx.Hash().Hex() || relays[1].Status != database.RelayPending {
+		t.Errorf("relays of the request = %+v, want the replacement journaled as pending", relays)
+	}
+}
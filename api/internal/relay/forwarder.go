@@ -0,0 +1,86 @@
+package relay
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EIP-712 domain of Forwarder.sol
+const (
+	ForwarderName    = "P2MForwarder"
+	ForwarderVersion = "1"
+)
+
+var (
+	domainTypeHash  = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	requestTypeHash = crypto.Keccak256([]byte("ForwardRequest(address from,address to,uint256 value,uint256 gas,uint256 nonce,uint256 deadline,bytes data)"))
+)
+
+// ForwardRequest mirrors Forwarder.ForwardRequest. Amounts fit in 64 bits for every request we relay.
+type ForwardRequest struct {
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	Value    uint64         `json:"value"`
+	Gas      uint64         `json:"gas"`
+	Nonce    uint64         `json:"nonce"`
+	Deadline uint64         `json:"deadline"`
+	Data     hexutil.Bytes  `json:"data"`
+}
+
+// Digest is the EIP-712 hash the recorder signs for the given forwarder deployment
+func (r *ForwardRequest) Digest(chainID *big.Int, forwarder common.Address) common.Hash {
+	domainSeparator := crypto.Keccak256(
+		domainTypeHash,
+		crypto.Keccak256([]byte(ForwarderName)),
+		crypto.Keccak256([]byte(ForwarderVersion)),
+		math.U256Bytes(new(big.Int).Set(chainID)),
+		common.LeftPadBytes(forwarder.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(
+		requestTypeHash,
+		common.LeftPadBytes(r.From.Bytes(), 32),
+		common.LeftPadBytes(r.To.Bytes(), 32),
+		uint256(r.Value),
+		uint256(r.Gas),
+		uint256(r.Nonce),
+		uint256(r.Deadline),
+		crypto.Keccak256(r.Data),
+	)
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domainSeparator, structHash)
+}
+
+// Signer recovers the account that signed the request. Like the contract it only
+// accepts 65 byte signatures with v = 27/28 and a low s value.
+func (r *ForwardRequest) Signer(chainID *big.Int, forwarder common.Address, signature []byte) (common.Address, error) {
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, errors.New("signature must be 65 bytes")
+	}
+	v := signature[crypto.RecoveryIDOffset]
+	if v != 27 && v != 28 {
+		return common.Address{}, errors.New("signature v must be 27 or 28")
+	}
+	rValue, sValue := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:64])
+	if !crypto.ValidateSignatureValues(v-27, rValue, sValue, true) {
+		return common.Address{}, errors.New("malformed signature")
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	copy(sig, signature)
+	sig[crypto.RecoveryIDOffset] -= 27
+
+	digest := r.Digest(chainID, forwarder)
+	publicKey, err := crypto.SigToPub(digest.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
+
+func uint256(n uint64) []byte {
+	return common.LeftPadBytes(new(big.Int).SetUint64(n).Bytes(), 32)
+}
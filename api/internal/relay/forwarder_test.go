@@ -0,0 +1,45 @@
+package relay
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// The expected digests were computed with go-ethereum's EIP-712 implementation
+// (signer/core/apitypes) over the ForwardRequest type of Forwarder.sol
+func TestDigest(t *testing.T) {
+	forwarder := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	full := ForwardRequest{
+		From:     common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		To:       common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		Gas:      300000,
+		Nonce:    7,
+		Deadline: 1700000000,
+		Data:     []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	empty := ForwardRequest{
+		From: common.HexToAddress("0x00000000000000000000000000000000000000aa"),
+		To:   common.HexToAddress("0x00000000000000000000000000000000000000bb"),
+	}
+
+	tests := []struct {
+		name    string
+		req     ForwardRequest
+		chainID int64
+		want    string
+	}{
+		{"testnet", full, 97, "0x0640e4754216b564ea2d5ce052511c2f027a8427dd4855831e3b510feb165232"},
+		{"mainnet", full, 56, "0x1e2335e9f442f01400021e80573f75a3faf13d6401de4c57400391f1423ae1b5"},
+		{"zero values and empty data", empty, 97, "0x3177c75ca4d7c3ab4cbb6423254e182246cb2ebe0c99cde42c687a9febedcff7"},
+		{"zero values on mainnet", empty, 56, "0x162bb1d5b81d008db4684d8b246d2c06ad6fba8396198ed349929fb0216a36ea"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.Digest(big.NewInt(tt.chainID), forwarder); got != common.HexToHash(tt.want) {
+				t.Errorf("Digest() = %s, want %s", got.Hex(), tt.want)
+			}
+		})
+	}
+}
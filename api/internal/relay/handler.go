@@ -0,0 +1,316 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"p2m-lite/internal/auth"
+	"p2m-lite/internal/contract"
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/payout"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDropped is reported for a request none of whose transactions reached the chain
+const RequestDropped = "dropped"
+
+// Calls of the P2M contract recorders may have relayed
+var relayedMethods = map[string]bool{"storeLog": true, "storeLogs": true}
+
+type RelayHandler struct {
+	payer     *payout.Service
+	target    common.Address
+	forwarder common.Address
+	instance  *contract.ForwarderContract
+
+	p2mABI       *abi.ABI
+	forwarderABI *abi.ABI
+
+	// mu serializes nonce checks with submissions so a request cannot be relayed twice
+	mu sync.Mutex
+}
+
+// NewHandler returns a handler that answers 503 until both the payer and the forwarder are configured
+func NewHandler(payer *payout.Service, contractAddress, forwarderAddress string) (*RelayHandler, error) {
+	p2mABI, err := contract.P2MContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	forwarderABI, err := contract.ForwarderContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &RelayHandler{payer: payer, p2mABI: p2mABI, forwarderABI: forwarderABI}
+	if payer == nil || !common.IsHexAddress(contractAddress) || !common.IsHexAddress(forwarderAddress) {
+		return h, nil
+	}
+
+	h.target = common.HexToAddress(contractAddress)
+	h.forwarder = common.HexToAddress(forwarderAddress)
+	h.instance, err = contract.NewForwarderContract(h.forwarder, payer.Client())
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind forwarder: %w", err)
+	}
+	return h, nil
+}
+
+func (h *RelayHandler) available(c *gin.Context) bool {
+	if h.instance == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Relay is not configured"})
+		return false
+	}
+	return true
+}
+
+// GetNonce tells a recorder everything it needs to sign its next request
+func (h *RelayHandler) GetNonce(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	h.mu.Lock()
+	nonce, err := h.nextNonce(c.Request.Context(), auth.Recorder(c))
+	h.mu.Unlock()
+	if err != nil {
+		log.Printf("Relay: Failed to read nonce: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read forwarder nonce"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"forwarder": h.forwarder.Hex(),
+		"contract":  h.target.Hex(),
+		"chain_id":  h.payer.ChainID().String(),
+		"nonce":     nonce,
+	})
+}
+
+type RelayRequest struct {
+	Request   ForwardRequest `json:"request"`
+	Signature hexutil.Bytes  `json:"signature" binding:"required"`
+}
+
+// RelayLogs submits a signed storeLog/storeLogs request through the forwarder, paying the gas
+func (h *RelayHandler) RelayLogs(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	var body RelayRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid relay payload: " + err.Error()})
+		return
+	}
+	req := body.Request
+	recorder := auth.Recorder(c)
+
+	if req.From != recorder {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Request must be signed by the authenticated recorder"})
+		return
+	}
+	if req.To != h.target || req.Value != 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only calls to the P2M contract without value are relayed"})
+		return
+	}
+	method, readings, err := h.decodeCall(req.Data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// The forwarder pays what the request asks for, so it may not ask for more than its readings need
+	maxGas := min(uint64(vals.RelayBaseGas+vals.RelayGasPerReading*readings), vals.RelayMaxGas)
+	if req.Gas == 0 || req.Gas > maxGas {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("gas must be between 1 and %d for %d readings", maxGas, readings)})
+		return
+	}
+	now := time.Now()
+	if req.Deadline < uint64(now.Unix()) || req.Deadline > uint64(now.Add(vals.RelayMaxDeadline).Unix()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deadline must lie within the next %s", vals.RelayMaxDeadline)})
+		return
+	}
+
+	signer, err := req.Signer(h.payer.ChainID(), h.forwarder, body.Signature)
+	if err != nil || signer != req.From {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Signature does not match the request"})
+		return
+	}
+
+	// Any key can sign in, but only recorders an operator registered spend the operator's gas
+	registered, err := database.IsRegisteredRecorder(recorder.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check recorder registration"})
+		return
+	}
+	if !registered {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Recorder is not registered for relaying"})
+		return
+	}
+
+	relayed, err := database.CountRelays(recorder.Hex(), now.Add(-time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check relay rate"})
+		return
+	}
+	if relayed >= vals.RelayHourlyLimit {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("At most %d requests are relayed per hour", vals.RelayHourlyLimit)})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := c.Request.Context()
+	nonce, err := h.nextNonce(ctx, recorder)
+	if err != nil {
+		log.Printf("Relay: Failed to read nonce: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to read forwarder nonce"})
+		return
+	}
+	if req.Nonce != nonce {
+		c.JSON(http.StatusConflict, gin.H{"error": "Stale nonce", "nonce": nonce})
+		return
+	}
+
+	tx, err := h.execute(ctx, req, body.Signature, database.Relay{
+		Recorder: recorder.Hex(),
+		Nonce:    req.Nonce,
+		Method:   method,
+		Readings: readings,
+		Gas:      req.Gas,
+	})
+	if errors.Is(err, payout.ErrBreakerOpen) {
+		_, reason, _ := h.payer.Breaker().State()
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Relaying is halted: " + reason})
+		return
+	}
+	if err != nil {
+		log.Printf("Relay: Failed to relay %s for %s: %v", method, recorder.Hex(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to relay request: " + err.Error()})
+		return
+	}
+	log.Printf("Relay: %s with %d readings from %s sent in %s", method, readings, recorder.Hex(), tx.Hash().Hex())
+
+	c.JSON(http.StatusOK, gin.H{"tx_hash": tx.Hash().Hex(), "nonce": req.Nonce})
+}
+
+// GetRequest reports whether a relayed request of the recorder was executed, so a
+// recorder that lost the answer to its submission does not sign the readings again
+func (h *RelayHandler) GetRequest(c *gin.Context) {
+	nonce, err := strconv.ParseUint(c.Param("nonce"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid nonce"})
+		return
+	}
+
+	relays, err := database.RelaysByNonce(auth.Recorder(c).Hex(), nonce)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up request"})
+		return
+	}
+	if len(relays) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Request was not relayed"})
+		return
+	}
+
+	status, latest := requestStatus(relays)
+	c.JSON(http.StatusOK, gin.H{
+		"nonce":        nonce,
+		"status":       status,
+		"tx_hash":      latest.TxHash,
+		"block_number": latest.BlockNumber,
+	})
+}
+
+// requestStatus sums up the transactions sent for one request: mined once one of them
+// executed it, pending while one still may, failed if they reverted and dropped when
+// other payer transactions took all their nonces. It also returns the deciding transaction.
+func requestStatus(relays []database.Relay) (string, database.Relay) {
+	status, latest := RequestDropped, relays[len(relays)-1]
+	for _, relay := range relays {
+		switch {
+		case relay.Status == database.RelayMined:
+			return database.RelayMined, relay
+		case relay.Status == database.RelayPending:
+			status, latest = database.RelayPending, relay
+		case relay.Status == database.RelayFailed && status != database.RelayPending:
+			status, latest = database.RelayFailed, relay
+		}
+	}
+	return status, latest
+}
+
+// decodeCall checks that data is a well-formed storeLog or storeLogs call and counts its readings
+func (h *RelayHandler) decodeCall(data []byte) (string, int, error) {
+	if len(data) < 4 {
+		return "", 0, errors.New("call data is too short")
+	}
+	method, err := h.p2mABI.MethodById(data[:4])
+	if err != nil || !relayedMethods[method.Name] {
+		return "", 0, errors.New("only storeLog and storeLogs are relayed")
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed %s arguments: %w", method.Name, err)
+	}
+
+	readings := 1
+	if method.Name == "storeLogs" {
+		phValues, _ := args[0].([]*big.Int)
+		readings = len(phValues)
+	}
+	return method.Name, readings, nil
+}
+
+// nextNonce is the forwarder nonce of the recorder, skipping past a request that is still being mined
+func (h *RelayHandler) nextNonce(ctx context.Context, recorder common.Address) (uint64, error) {
+	onChain, err := h.instance.GetNonce(&bind.CallOpts{Context: ctx}, recorder)
+	if err != nil {
+		return 0, err
+	}
+	nonce := onChain.Uint64()
+
+	last, err := database.LatestRelay(recorder.Hex())
+	if err != nil || last == nil || last.Nonce < nonce {
+		return nonce, err
+	}
+	relays, err := database.RelaysByNonce(recorder.Hex(), last.Nonce)
+	if err != nil {
+		return 0, err
+	}
+	// A request that reverted or was dropped did not use up its nonce
+	if status, _ := requestStatus(relays); status == database.RelayPending || status == database.RelayMined {
+		return last.Nonce + 1, nil
+	}
+	return nonce, nil
+}
+
+func (h *RelayHandler) execute(ctx context.Context, req ForwardRequest, signature []byte, relay database.Relay) (*types.Transaction, error) {
+	data, err := h.forwarderABI.Pack("execute", contract.ForwarderForwardRequest{
+		From:     req.From,
+		To:       req.To,
+		Value:    new(big.Int).SetUint64(req.Value),
+		Gas:      new(big.Int).SetUint64(req.Gas),
+		Nonce:    new(big.Int).SetUint64(req.Nonce),
+		Deadline: new(big.Int).SetUint64(req.Deadline),
+		Data:     req.Data,
+	}, signature)
+	if err != nil {
+		return nil, err
+	}
+	return h.payer.Relay(ctx, h.forwarder, data, relay)
+}
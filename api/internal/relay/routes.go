@@ -0,0 +1,26 @@
+package relay
+
+import (
+	"log"
+
+	"p2m-lite/config"
+	"p2m-lite/internal/auth"
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/payout"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetupRoutes(r *gin.Engine, cfg *config.Config, db *database.Store, payer *payout.Service) {
+	handler, err := NewHandler(payer, cfg.ContractAddress, cfg.ForwarderAddress)
+	if err != nil {
+		log.Fatalf("Failed to set up relay: %v", err)
+	}
+	relayGroup := r.Group("/api/relay", auth.RequireSession(db))
+	{
+		// Recorders without gas sign their readings and the API submits them
+		relayGroup.GET("/nonce", handler.GetNonce)
+		relayGroup.POST("/logs", handler.RelayLogs)
+		relayGroup.GET("/requests/:nonce", handler.GetRequest)
+	}
+}
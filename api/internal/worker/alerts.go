@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/vals"
+)
+
+// alertData is what the alert templates can refer to
+type alertData struct {
+	Recorder       string
+	Severity       string
+	AvgPH          float64
+	AvgTurbidity   float64
+	Lat            float64
+	Lon            float64
+	MapsURL        string
+	IncidentID     uint
+	OpenedAt       time.Time
+	UnsubscribeURL string
+}
+
+func newAlertData(stats recorderStats, lat, lon float64) alertData {
+	return alertData{
+		Recorder:     stats.Recorder,
+		Severity:     alertSeverity(stats),
+		AvgPH:        stats.AvgPH,
+		AvgTurbidity: stats.AvgTurbidity,
+		Lat:          lat,
+		Lon:          lon,
+		MapsURL:      fmt.Sprintf("https://www.google.com/maps/search/?api=1&query=%f,%f", lat, lon),
+	}
+}
+
+// alertNotifications renders the named template for every subscriber interested in the
+// recorder and severity, in the subscriber's language. When nobody subscribed, the
+// channels' default recipients get it so alerts are never dropped.
+func (a *Analyzer) alertNotifications(template string, data alertData) ([]database.Notification, error) {
+	subs, err := database.SubscriptionsFor(data.Recorder, data.Lat, data.Lon)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subscriptions: %w", err)
+	}
+
+	matched := 0
+	var notifications []database.Notification
+	for _, sub := range subs {
+		if !notify.AtLeast(data.Severity, sub.MinSeverity) {
+			continue
+		}
+		matched++
+
+		if a.outbox.Notifier().Channel(sub.Channel) == nil {
+			log.Printf("Notify: Subscription %d uses disabled channel %s", sub.ID, sub.Channel)
+			continue
+		}
+		subData := data
+		subData.UnsubscribeURL = a.unsubscribeURL(sub.Token)
+		msg, err := a.templates.Render(template, sub.Language, subData)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, newNotification(sub.Channel, sub.Recipient, msg))
+	}
+
+	if matched == 0 {
+		msg, err := a.templates.Render(template, a.cfg.AlertLanguage, data)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, a.outbox.broadcast(msg)...)
+	}
+	return notifications, nil
+}
+
+func (a *Analyzer) unsubscribeURL(token string) string {
+	return a.cfg.PublicURL + "/api/subscriptions/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// alertSeverity marks readings far outside the thresholds as critical
+func alertSeverity(stats recorderStats) string {
+	if stats.AvgPH < vals.MinPH-1 || stats.AvgPH > vals.MaxPH+1 || stats.AvgTurbidity > 2*vals.MaxTurbidity {
+		return notify.SeverityCritical
+	}
+	return notify.SeverityWarning
+}
+
+// OperatorMessage describes operational problems such as halted payouts
+func OperatorMessage(templates *notify.Templates, lang, title, message string) (notify.Message, error) {
+	return templates.Render("operator", lang, struct{ Title, Message string }{title, message})
+}
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"slices"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/payout"
+	"p2m-lite/vals"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// StartConfirmer polls receipts of pending rewards and relays and settles their status
+func StartConfirmer(ctx context.Context, payer *payout.Service) {
+	if payer == nil {
+		log.Println("Confirmer: Payout service unavailable, not starting")
+		return
+	}
+	running.Go(func() {
+		ticker := time.NewTicker(vals.ReceiptPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				confirmTransactions(payer)
+			}
+		}
+	})
+}
+
+// sentTx is a pending transaction of the payer account, a reward or a relay. Both
+// share the nonce sequence, so the confirmer settles them together.
+type sentTx struct {
+	hash    common.Hash
+	nonce   uint64
+	created int64
+	label   string
+	settle  func(status string, blockNumber, gasUsed uint64)
+	resend  func(ctx context.Context) (*types.Transaction, error)
+}
+
+func confirmTransactions(payer *payout.Service) {
+	pending, err := pendingTxs(payer)
+	if err != nil {
+		log.Printf("Confirmer: Failed to query pending transactions: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	client := payer.Client()
+
+	// Rebroadcasts share a nonce with the original, only the newest one per nonce may be bumped
+	latest := make(map[uint64]sentTx)
+	mined := make(map[uint64]bool)
+	var unseen []sentTx
+	for _, tx := range pending {
+		receipt, err := client.TransactionReceipt(ctx, tx.hash)
+		if errors.Is(err, ethereum.NotFound) {
+			unseen = append(unseen, tx)
+			continue
+		}
+		if err != nil {
+			log.Printf("Confirmer: Failed to fetch receipt for %s: %v", tx.hash.Hex(), err)
+			continue
+		}
+		settleReceipt(tx, receipt)
+		mined[tx.nonce] = true
+	}
+
+	for _, tx := range unseen {
+		if mined[tx.nonce] {
+			log.Printf("Confirmer: %s was replaced by a rebroadcast", tx.label)
+			tx.settle(database.RewardReplaced, 0, 0)
+			continue
+		}
+		// The nonce may have been consumed by this very transaction after its receipt was
+		// fetched, so only a receipt still missing once the nonce is used means replaced
+		confirmedNonce, err := client.NonceAt(ctx, payer.Address(), nil)
+		if err == nil && confirmedNonce > tx.nonce {
+			receipt, err := client.TransactionReceipt(ctx, tx.hash)
+			if err == nil {
+				settleReceipt(tx, receipt)
+				continue
+			}
+			if errors.Is(err, ethereum.NotFound) && !siblingPending(ctx, client, pending, tx) {
+				log.Printf("Confirmer: %s was replaced", tx.label)
+				tx.settle(database.RewardReplaced, 0, 0)
+			}
+			continue
+		}
+		if prev, ok := latest[tx.nonce]; !ok || tx.created >= prev.created {
+			latest[tx.nonce] = tx
+		}
+	}
+
+	stuckBefore := time.Now().Add(-vals.StuckTxTimeout).Unix()
+	for _, tx := range latest {
+		if tx.created > stuckBefore {
+			continue
+		}
+		replacement, err := tx.resend(ctx)
+		if err != nil {
+			log.Printf("Confirmer: Failed to rebroadcast %s: %v", tx.label, err)
+			continue
+		}
+		log.Printf("Confirmer: %s stuck, rebroadcast as %s", tx.label, replacement.Hash().Hex())
+	}
+}
+
+// pendingTxs collects the pending rewards and relays, oldest first
+func pendingTxs(payer *payout.Service) ([]sentTx, error) {
+	rewards, err := database.PendingRewards()
+	if err != nil {
+		return nil, err
+	}
+	relays, err := database.PendingRelays()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]sentTx, 0, len(rewards)+len(relays))
+	for _, reward := range rewards {
+		pending = append(pending, sentTx{
+			hash:    common.HexToHash(reward.TxHash),
+			nonce:   reward.Nonce,
+			created: reward.CreatedAt,
+			label:   fmt.Sprintf("Reward %s for %s", reward.TxHash, reward.Recorder),
+			settle: func(status string, blockNumber, gasUsed uint64) {
+				if err := database.UpdateRewardStatus(reward.ID, status, blockNumber, gasUsed); err != nil {
+					log.Printf("Confirmer: Failed to update reward %s: %v", reward.TxHash, err)
+				}
+				if status == database.RewardMined {
+					markProcessed(reward.Recorder)
+				}
+			},
+			resend: func(ctx context.Context) (*types.Transaction, error) {
+				value, ok := new(big.Int).SetString(reward.Amount, 10)
+				if !ok {
+					return nil, fmt.Errorf("invalid amount %q", reward.Amount)
+				}
+				return payer.Resend(ctx, common.HexToHash(reward.TxHash), reward.Nonce, common.HexToAddress(reward.Recorder), value)
+			},
+		})
+	}
+	for _, relay := range relays {
+		pending = append(pending, sentTx{
+			hash:    common.HexToHash(relay.TxHash),
+			nonce:   relay.TxNonce,
+			created: relay.CreatedAt,
+			label:   fmt.Sprintf("Relay %s of %s for %s", relay.TxHash, relay.Method, relay.Recorder),
+			settle: func(status string, blockNumber, gasUsed uint64) {
+				if err := database.UpdateRelayStatus(relay.ID, status, blockNumber, gasUsed); err != nil {
+					log.Printf("Confirmer: Failed to update relay %s: %v", relay.TxHash, err)
+				}
+			},
+			resend: func(ctx context.Context) (*types.Transaction, error) {
+				return payer.ResendRelay(ctx, relay)
+			},
+		})
+	}
+	slices.SortStableFunc(pending, func(a, b sentTx) int {
+		return cmp.Compare(a.nonce, b.nonce)
+	})
+	return pending, nil
+}
+
+// siblingPending reports whether another transaction with the same nonce was mined since
+// its receipt was last fetched. It is left for the next round to settle both.
+func siblingPending(ctx context.Context, client *ethclient.Client, pending []sentTx, tx sentTx) bool {
+	for _, sibling := range pending {
+		if sibling.hash == tx.hash || sibling.nonce != tx.nonce {
+			continue
+		}
+		if _, err := client.TransactionReceipt(ctx, sibling.hash); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func settleReceipt(tx sentTx, receipt *types.Receipt) {
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		log.Printf("Confirmer: %s mined in block %d", tx.label, receipt.BlockNumber.Uint64())
+		tx.settle(database.RewardMined, receipt.BlockNumber.Uint64(), receipt.GasUsed)
+		return
+	}
+	log.Printf("Confirmer: %s failed in block %d", tx.label, receipt.BlockNumber.Uint64())
+	tx.settle(database.RewardFailed, receipt.BlockNumber.Uint64(), receipt.GasUsed)
+}
@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/vals"
+)
+
+// StartDeviceMonitor marks recorders offline once their daemon stops sending heartbeats
+func StartDeviceMonitor(ctx context.Context) {
+	running.Go(func() {
+		ticker := time.NewTicker(vals.DeviceCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				markSilentDevices()
+			}
+		}
+	})
+}
+
+func markSilentDevices() {
+	devices, err := database.MarkDevicesOffline(time.Now().Add(-vals.DeviceOfflineAfter))
+	if err != nil {
+		log.Printf("Devices: Failed to mark silent devices offline: %v", err)
+	}
+	for _, device := range devices {
+		log.Printf("Devices: %s is offline, last heartbeat at %s", device.Recorder, time.Unix(device.LastHeartbeatAt, 0).Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/vals"
+)
+
+// openIncident records a new breach and alerts its subscribers. The incident and its
+// alerts are stored together, when that fails neither is kept and the next cycle retries.
+func (a *Analyzer) openIncident(stats recorderStats, reason string) (*database.Incident, error) {
+	lat, lon := database.GetRecorderLocation(stats.Recorder)
+	data := newAlertData(stats, lat, lon)
+
+	incident := &database.Incident{
+		Recorder:     stats.Recorder,
+		Severity:     data.Severity,
+		Reason:       reason,
+		AvgPH:        stats.AvgPH,
+		AvgTurbidity: stats.AvgTurbidity,
+	}
+	var total int
+	enqueued, err := database.OpenIncident(incident, func(incident *database.Incident) ([]database.Notification, error) {
+		data.IncidentID = incident.ID
+		data.OpenedAt = time.Unix(incident.OpenedAt, 0)
+		notifications, err := a.alertNotifications("low_quality", data)
+		total = len(notifications)
+		return notifications, err
+	}, vals.OutboxDedupWindow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open incident: %w", err)
+	}
+	logDuplicates(total, enqueued)
+	log.Printf("Analyzer: Opened incident %d for %s", incident.ID, stats.Recorder)
+	return incident, nil
+}
+
+// resolveIncident closes an incident whose recorder is back within thresholds and sends a recovery notice
+func (a *Analyzer) resolveIncident(incident *database.Incident, stats recorderStats) error {
+	lat, lon := database.GetRecorderLocation(incident.Recorder)
+	data := newAlertData(stats, lat, lon)
+	data.IncidentID = incident.ID
+	data.OpenedAt = time.Unix(incident.OpenedAt, 0)
+	// Recovery notices reach everyone who received the alert
+	data.Severity = incident.Severity
+	notices, err := a.alertNotifications("recovered", data)
+	if err != nil {
+		return err
+	}
+
+	enqueued, err := database.ResolveIncident(incident, notices, vals.OutboxDedupWindow)
+	if err != nil {
+		return fmt.Errorf("failed to resolve incident: %w", err)
+	}
+	logDuplicates(len(notices), enqueued)
+	log.Printf("Analyzer: Resolved incident %d for %s", incident.ID, incident.Recorder)
+	return nil
+}
+
+// watchIncidents periodically escalates incidents nobody acknowledged in time
+func (a *Analyzer) watchIncidents() {
+	ticker := time.NewTicker(vals.IncidentCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			a.escalateIncidents()
+		}
+	}
+}
+
+func (a *Analyzer) escalateIncidents() {
+	deadline := time.Now().Add(-vals.IncidentEscalationAfter).Unix()
+	incidents, err := database.UnacknowledgedIncidents(deadline)
+	if err != nil {
+		log.Printf("Analyzer: Failed to load unacknowledged incidents: %v", err)
+		return
+	}
+
+	for i := range incidents {
+		incident := &incidents[i]
+		lat, lon := database.GetRecorderLocation(incident.Recorder)
+		data := newAlertData(recorderStats{
+			Recorder:     incident.Recorder,
+			AvgPH:        incident.AvgPH,
+			AvgTurbidity: incident.AvgTurbidity,
+		}, lat, lon)
+		data.IncidentID = incident.ID
+		data.OpenedAt = time.Unix(incident.OpenedAt, 0)
+		// Escalations reach subscribers of critical alerts and the operators
+		data.Severity = notify.SeverityCritical
+
+		notices, err := a.alertNotifications("escalation", data)
+		if err == nil {
+			var msg notify.Message
+			if msg, err = a.templates.Render("escalation", a.cfg.AlertLanguage, data); err == nil {
+				notices = append(notices, a.outbox.broadcast(msg)...)
+			}
+		}
+		if err != nil {
+			log.Printf("Analyzer: Failed to prepare escalation of incident %d: %v", incident.ID, err)
+			continue
+		}
+
+		// Nothing is marked escalated unless every notice was queued, so failures are retried
+		claimed, enqueued, err := database.EscalateIncident(incident, notices, vals.OutboxDedupWindow)
+		if err != nil {
+			log.Printf("Analyzer: Failed to escalate incident %d, retrying on the next check: %v", incident.ID, err)
+			continue
+		}
+		if claimed {
+			logDuplicates(len(notices), enqueued)
+			log.Printf("Analyzer: Escalated incident %d for %s, unacknowledged since %s", incident.ID, incident.Recorder, data.OpenedAt.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/vals"
+)
+
+// outboxBatchSize caps how many notifications one poll delivers
+const outboxBatchSize = 50
+
+// Outbox persists notifications and delivers them in the background, so a flaky
+// channel delays an alert instead of losing it
+type Outbox struct {
+	notifier *notify.Dispatcher
+}
+
+// StartOutbox delivers due notifications until ctx is cancelled. Undelivered ones
+// stay in the database for the next start.
+func StartOutbox(ctx context.Context, notifier *notify.Dispatcher) *Outbox {
+	o := &Outbox{notifier: notifier}
+	log.Println("Outbox: Started delivery worker")
+	running.Go(func() {
+		ticker := time.NewTicker(vals.OutboxPollInterval)
+		defer ticker.Stop()
+
+		o.deliverDue(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				o.deliverDue(ctx)
+			}
+		}
+	})
+	return o
+}
+
+func (o *Outbox) Notifier() *notify.Dispatcher {
+	return o.notifier
+}
+
+// Enqueue stores msg for delivery on one channel. An empty recipient means the channel's default.
+func (o *Outbox) Enqueue(channel, recipient string, msg notify.Message) error {
+	n := newNotification(channel, recipient, msg)
+	enqueued, err := database.EnqueueNotification(&n, vals.OutboxDedupWindow)
+	if err != nil {
+		log.Printf("Outbox: Failed to enqueue %s notification: %v", channel, err)
+		return err
+	}
+	if !enqueued {
+		log.Printf("Outbox: Skipping duplicate %s notification %q", channel, msg.Subject)
+	}
+	return nil
+}
+
+// EnqueueAll stores several notifications at once, or none of them when it fails
+func (o *Outbox) EnqueueAll(notifications []database.Notification) error {
+	enqueued, err := database.EnqueueNotifications(notifications, vals.OutboxDedupWindow)
+	if err != nil {
+		log.Printf("Outbox: Failed to enqueue %d notifications: %v", len(notifications), err)
+		return err
+	}
+	logDuplicates(len(notifications), enqueued)
+	return nil
+}
+
+// Broadcast enqueues msg for the default recipient of every enabled channel
+func (o *Outbox) Broadcast(msg notify.Message) error {
+	return o.EnqueueAll(o.broadcast(msg))
+}
+
+// broadcast addresses msg to the default recipient of every enabled channel
+func (o *Outbox) broadcast(msg notify.Message) []database.Notification {
+	var notifications []database.Notification
+	for _, ch := range o.notifier.Channels() {
+		notifications = append(notifications, newNotification(ch.Name(), "", msg))
+	}
+	return notifications
+}
+
+func newNotification(channel, recipient string, msg notify.Message) database.Notification {
+	return database.Notification{
+		Channel:   channel,
+		Recipient: recipient,
+		Subject:   msg.Subject,
+		Text:      msg.Text,
+		HTML:      msg.HTML,
+		DedupKey:  dedupKey(channel, recipient, msg),
+	}
+}
+
+func logDuplicates(total, enqueued int) {
+	if skipped := total - enqueued; skipped > 0 {
+		log.Printf("Outbox: Skipping %d duplicate notifications", skipped)
+	}
+}
+
+func dedupKey(channel, recipient string, msg notify.Message) string {
+	h := sha256.New()
+	for _, part := range []string{channel, recipient, msg.Subject, msg.Text, msg.HTML} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (o *Outbox) deliverDue(ctx context.Context) {
+	due, err := database.DueNotifications(time.Now().Unix(), outboxBatchSize)
+	if err != nil {
+		log.Printf("Outbox: Error loading due notifications: %v", err)
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		o.deliver(ctx, &due[i])
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, n *database.Notification) {
+	n.Attempts++
+	attempt := database.NotificationAttempt{NotificationID: n.ID, Attempt: n.Attempts}
+
+	var err error
+	if ch := o.notifier.Channel(n.Channel); ch == nil {
+		err = notify.ErrUnknownChannel
+	} else {
+		err = ch.Send(ctx, n.Recipient, notify.Message{Subject: n.Subject, Text: n.Text, HTML: n.HTML})
+	}
+	// A send cut short by shutdown is no failed attempt, the notification stays due for the next start
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	now := time.Now()
+	if err == nil {
+		attempt.Succeeded = true
+		n.Status = database.NotificationSent
+		n.SentAt = now.Unix()
+		n.LastError = ""
+	} else {
+		attempt.Error = err.Error()
+		n.LastError = err.Error()
+		// Retrying cannot fix a missing channel or recipient
+		permanent := errors.Is(err, notify.ErrUnknownChannel) || errors.Is(err, notify.ErrNoRecipient)
+		if n.Attempts >= vals.OutboxMaxAttempts || permanent {
+			n.Status = database.NotificationDead
+			log.Printf("Outbox: Notification %d via %s dead-lettered after %d attempts: %v", n.ID, n.Channel, n.Attempts, err)
+		} else {
+			next := outboxBackoff(n.Attempts)
+			n.NextAttemptAt = now.Add(next).Unix()
+			log.Printf("Outbox: Notification %d via %s failed (attempt %d), retrying in %s: %v", n.ID, n.Channel, n.Attempts, next, err)
+		}
+	}
+
+	if err := database.SaveNotificationAttempt(n, &attempt); err != nil {
+		log.Printf("Outbox: Error saving attempt of notification %d: %v", n.ID, err)
+	}
+}
+
+// outboxBackoff doubles the retry delay with every failed attempt
+func outboxBackoff(attempts int) time.Duration {
+	d := vals.OutboxBaseBackoff
+	for i := 1; i < attempts && d < vals.OutboxMaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, vals.OutboxMaxBackoff)
+}
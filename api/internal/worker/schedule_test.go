@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday
+	after := time.Date(2025, 1, 15, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"6h", after, time.Date(2025, 1, 15, 16, 17, 30, 0, time.UTC)},
+		{"@every 90m", after, time.Date(2025, 1, 15, 11, 47, 30, 0, time.UTC)},
+		{"*/15 * * * *", after, time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", after, time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", after, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", after, time.Date(2025, 1, 15, 13, 0, 0, 0, time.UTC)},
+		{"30 2 * * 1", after, time.Date(2025, 1, 20, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", after, time.Date(2025, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", after, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// Restricted day of month and day of week match either
+		{"0 12 13 * 5", after, time.Date(2025, 1, 17, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2025, 12, 31, 23, 59, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", after, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", after, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, expr := range []string{"", "30s", "* * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "0 0 0 * *"} {
+		if _, err := ParseSchedule(expr); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", expr)
+		}
+	}
+}
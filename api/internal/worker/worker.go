@@ -2,29 +2,53 @@ package worker
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"log"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 
 	"p2m-lite/config"
 	"p2m-lite/internal/contract"
 	"p2m-lite/internal/database"
+	"p2m-lite/internal/notify"
+	"p2m-lite/internal/payout"
 	"p2m-lite/vals"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
-func StartListener(cfg *config.Config) {
+// running tracks the goroutines of every started worker, see Wait
+var running sync.WaitGroup
+
+// Wait blocks until every worker stopped after the context they were started
+// with was cancelled, or fails once ctx is done
+func Wait(ctx context.Context) error {
+	done := make(chan struct{})
 	go func() {
-		client, err := ethclient.Dial(cfg.BlockchainURL)
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %w", ctx.Err())
+	}
+}
+
+func StartListener(ctx context.Context, cfg *config.Config) {
+	running.Go(func() {
+		client, err := ethclient.DialContext(ctx, cfg.BlockchainURL)
 		if err != nil {
 			log.Printf("Listener: Failed to connect to blockchain: %v", err)
 			return
 		}
+		defer client.Close()
 
 		contractAddr := common.HexToAddress(cfg.ContractAddress)
 		p2m, err := contract.NewP2MContract(contractAddr, client)
@@ -42,102 +66,376 @@ func StartListener(cfg *config.Config) {
 		}
 		defer sub.Unsubscribe()
 
+		batches := make(chan *contract.P2MContractLogBatchStored)
+		batchSub, err := p2m.WatchLogBatchStored(nil, batches, nil)
+		if err != nil {
+			log.Printf("Listener: Failed to subscribe to log batches: %v", err)
+			return
+		}
+		defer batchSub.Unsubscribe()
+
 		log.Println("Listener: Started listening for blockchain events...")
 
 		for {
 			select {
+			case <-ctx.Done():
+				log.Println("Listener: Stopped")
+				return
 			case err := <-sub.Err():
 				log.Printf("Listener: Subscription error: %v", err)
 				// Reconnect logic could go here
 				return
+			case err := <-batchSub.Err():
+				log.Printf("Listener: Batch subscription error: %v", err)
+				return
 			case vLog := <-logs:
-				recorderAddr := vLog.Recorder.Hex() // Keep original casing or normalize?
-				// Let's rely on DB COLLATE NOCASE, but passing Hex() is standard.
-
-				// Fetch location
-				lat, lon := database.GetRecorderLocation(recorderAddr)
-
-				// Insert into DB
-				newLog := database.Log{
-					Recorder:  recorderAddr,
-					Ph:        int(vLog.PhValue.Int64()),
-					Turbidity: int(vLog.Turbidity.Int64()),
-					Timestamp: vLog.Timestamp.Int64(),
-					Lat:       lat,
-					Lon:       lon,
-				}
-				if err := database.DB.Create(&newLog).Error; err != nil {
-					log.Printf("Listener: Failed to insert log: %v", err)
-				} else {
-					log.Printf("Listener: Log stored for %s", vLog.Recorder.Hex())
-				}
+				storeLogs(vLog.Recorder, []*big.Int{vLog.PhValue}, []*big.Int{vLog.Turbidity}, []*big.Int{vLog.Timestamp})
+			case batch := <-batches:
+				storeLogs(batch.Recorder, batch.PhValues, batch.Turbidities, batch.Timestamps)
 			}
 		}
-	}()
+	})
 }
 
-func StartAnalyzer(cfg *config.Config) {
-	ticker := time.NewTicker(vals.AnalysisIntervalHours)
-	go func() {
-		for range ticker.C {
-			log.Println("Analyzer: Starting analysis cycle...")
-			analyze(cfg)
+// storeLogs inserts the readings of one LogStored or LogBatchStored event
+func storeLogs(recorder common.Address, phValues, turbidities, timestamps []*big.Int) {
+	if len(turbidities) != len(phValues) || len(timestamps) != len(phValues) {
+		log.Printf("Listener: Ignoring malformed batch from %s", recorder.Hex())
+		return
+	}
+	recorderAddr := recorder.Hex() // Keep original casing or normalize?
+	// Let's rely on DB COLLATE NOCASE, but passing Hex() is standard.
+
+	// Fetch location
+	lat, lon := database.GetRecorderLocation(recorderAddr)
+
+	// Insert into DB
+	newLogs := make([]database.Log, 0, len(phValues))
+	for i := range phValues {
+		newLogs = append(newLogs, database.Log{
+			Recorder:  recorderAddr,
+			Ph:        int(phValues[i].Int64()),
+			Turbidity: int(turbidities[i].Int64()),
+			Timestamp: timestamps[i].Int64(),
+			Lat:       lat,
+			Lon:       lon,
+		})
+	}
+	if err := database.DB.Create(&newLogs).Error; err != nil {
+		log.Printf("Listener: Failed to insert log: %v", err)
+	} else if len(newLogs) == 1 {
+		log.Printf("Listener: Log stored for %s", recorderAddr)
+	} else {
+		log.Printf("Listener: %d logs stored for %s", len(newLogs), recorderAddr)
+	}
+}
+
+// ErrAnalyzerBusy is returned when a cycle is requested while another one is running
+var ErrAnalyzerBusy = errors.New("an analyzer cycle is already running")
+
+// ErrAnalyzerStopped is returned when a cycle is requested after shutdown began
+var ErrAnalyzerStopped = errors.New("the analyzer is shutting down")
+
+// RunOptions tweak a single analyzer invocation
+type RunOptions struct {
+	// DryRun evaluates every recorder but only records the decisions instead of
+	// sending emails or rewards
+	DryRun bool
+	// Recorder limits the cycle to a single recorder when set
+	Recorder string
+	// Trigger records what started the cycle (schedule, startup, manual)
+	Trigger string
+}
+
+// Analyzer runs analysis cycles on a schedule or on demand, never two at a time
+type Analyzer struct {
+	// ctx is cancelled on shutdown, a running cycle then stops after the current recorder
+	ctx       context.Context
+	cfg       *config.Config
+	payer     *payout.Service
+	outbox    *Outbox
+	templates *notify.Templates
+	mu        sync.Mutex
+}
+
+func StartAnalyzer(ctx context.Context, cfg *config.Config, payer *payout.Service, outbox *Outbox, templates *notify.Templates) *Analyzer {
+	a := &Analyzer{ctx: ctx, cfg: cfg, payer: payer, outbox: outbox, templates: templates}
+
+	var schedule Schedule = intervalSchedule(vals.AnalysisInterval)
+	if cfg.AnalyzerSchedule != "" {
+		parsed, err := ParseSchedule(cfg.AnalyzerSchedule)
+		if err != nil {
+			log.Printf("Analyzer: %v. Falling back to every %s.", err, vals.AnalysisInterval)
+		} else {
+			schedule = parsed
 		}
-	}()
+	}
+
+	running.Go(a.watchIncidents)
+
+	running.Go(func() {
+		if cfg.AnalyzerRunOnStart {
+			a.runScheduled(database.TriggerStartup)
+		}
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Println("Analyzer: Schedule never fires again, stopping scheduler")
+				return
+			}
+			log.Printf("Analyzer: Next cycle at %s", next.Format(time.RFC3339))
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				log.Println("Analyzer: Scheduler stopped")
+				return
+			case <-timer.C:
+			}
+			a.runScheduled(database.TriggerSchedule)
+		}
+	})
+	return a
+}
+
+func (a *Analyzer) runScheduled(trigger string) {
+	log.Println("Analyzer: Starting analysis cycle...")
+	_, err := a.Run(RunOptions{DryRun: a.cfg.AnalyzerDryRun, Trigger: trigger})
+	switch {
+	case errors.Is(err, ErrAnalyzerBusy):
+		log.Println("Analyzer: Previous cycle still running, skipping this one")
+	case errors.Is(err, ErrAnalyzerStopped):
+		log.Println("Analyzer: Shutting down, skipping this cycle")
+	}
 }
 
-func analyze(cfg *config.Config) {
+// Run executes one analyzer cycle and returns its run record.
+// It fails with ErrAnalyzerBusy instead of overlapping a cycle already in progress.
+func (a *Analyzer) Run(opts RunOptions) (*database.AnalyzerRun, error) {
+	if !a.mu.TryLock() {
+		return nil, ErrAnalyzerBusy
+	}
+	defer a.mu.Unlock()
+	if err := a.ctx.Err(); err != nil {
+		return nil, ErrAnalyzerStopped
+	}
+
+	run, err := database.StartAnalyzerRun(opts.DryRun, opts.Recorder, opts.Trigger, time.Now().Unix())
+	if err != nil {
+		log.Printf("Analyzer: Failed to record run: %v", err)
+		return nil, err
+	}
+	if opts.DryRun {
+		log.Printf("Analyzer: Run %d is a dry run, no emails or rewards will be sent", run.ID)
+	}
+
+	a.analyze(run, opts)
+
+	if err := database.FinishAnalyzerRun(run, time.Now().Unix()); err != nil {
+		log.Printf("Analyzer: Failed to finish run %d: %v", run.ID, err)
+	}
+	return run, nil
+}
+
+func (a *Analyzer) analyze(run *database.AnalyzerRun, opts RunOptions) {
 	// 1. Get all unique recorders from logs in the last M days
-	cutoff := time.Now().AddDate(0, 0, -vals.LookbackPeriodDays).Unix()
+	now := time.Now()
+	window := analysisWindow{
+		start: now.AddDate(0, 0, -vals.LookbackPeriodDays).Unix(),
+		end:   now.Unix(),
+	}
 
-	type Result struct {
-		Recorder     string
-		AvgPH        float64
-		AvgTurbidity float64
+	query := database.DB.Model(&database.Log{}).
+		Select("recorder, COUNT(*) as samples, AVG(ph) as avg_ph, AVG(turbidity) as avg_turbidity").
+		Where("timestamp > ?", window.start)
+	if opts.Recorder != "" {
+		query = query.Where("recorder = ?", opts.Recorder)
 	}
 
-	var results []Result
-	err := database.DB.Model(&database.Log{}).
-		Select("recorder, AVG(ph) as avg_ph, AVG(turbidity) as avg_turbidity").
-		Where("timestamp > ?", cutoff).
-		Group("recorder").
-		Scan(&results).Error
+	var results []recorderStats
+	err := query.Group("recorder").Scan(&results).Error
 
 	if err != nil {
 		log.Printf("Analyzer: Failed to query logs: %v", err)
 		return
 	}
 
+	var cycle *payout.Cycle
+	if a.payer != nil && !opts.DryRun {
+		cycle = a.payer.NewCycle()
+	}
+	payoutsHalted := false
+
 	for _, res := range results {
+		if a.ctx.Err() != nil {
+			log.Printf("Analyzer: Shutting down, run %d stops before %s", run.ID, res.Recorder)
+			break
+		}
 		recorder := res.Recorder
-		avgPH := res.AvgPH
-		avgTurbidity := res.AvgTurbidity
+		decision := newDecision(run, window, res)
+
+		// 2. Evaluate Quality
+		isLowQuality, explanation := evaluateQuality(res)
 
-		// 2. Check if processed recently (Cooldown N days)
+		incident, err := database.ActiveIncident(recorder)
+		if err != nil {
+			recordDecision(decision, database.OutcomeFailure, "incident state unavailable", err)
+			continue
+		}
+
+		// 3. Track the incident lifecycle: open on a breach, resolve on recovery
+		if isLowQuality {
+			if incident != nil {
+				if !opts.DryRun {
+					if err := database.TouchIncident(incident, alertSeverity(res), res.AvgPH, res.AvgTurbidity); err != nil {
+						log.Printf("Analyzer: Failed to update incident %d: %v", incident.ID, err)
+					}
+				}
+				recordDecision(decision, database.OutcomeIncidentOpen, fmt.Sprintf("incident %d is %s: %s", incident.ID, incident.Status, explanation), nil)
+				continue
+			}
+			if opts.DryRun {
+				recordDecision(decision, database.OutcomeAlert, explanation, nil)
+				continue
+			}
+
+			log.Printf("Analyzer: Low quality detected for %s. Queueing alert...", recorder)
+			if _, err := a.openIncident(res, explanation); err != nil {
+				recordDecision(decision, database.OutcomeFailure, "alert could not be queued: "+explanation, err)
+				continue
+			}
+			// 4. Mark as processed so the recorder is not rewarded during the cooldown
+			markProcessed(recorder)
+			recordDecision(decision, database.OutcomeAlert, explanation, nil)
+			continue
+		}
+
+		if incident != nil {
+			reason := fmt.Sprintf("incident %d resolved: %s", incident.ID, explanation)
+			if !opts.DryRun {
+				if err := a.resolveIncident(incident, res); err != nil {
+					recordDecision(decision, database.OutcomeFailure, reason, err)
+					continue
+				}
+			}
+			recordDecision(decision, database.OutcomeResolve, reason, nil)
+			continue
+		}
+
+		// 5. Rewards: check if processed recently (Cooldown N days)
 		if isProcessed(recorder) {
-			log.Printf("Analyzer: Skipping %s (Cooldown)", recorder)
+			recordDecision(decision, database.OutcomeCooldownSkip, fmt.Sprintf("processed within the last %d days", vals.CooldownPeriodDays), nil)
+			continue
+		}
+		if database.HasPendingReward(recorder) {
+			recordDecision(decision, database.OutcomePendingSkip, "previous reward is still waiting for confirmation", nil)
 			continue
 		}
 
-		// 3. Evaluate Quality
-		isLowQuality := avgPH < vals.MinPH || avgPH > vals.MaxPH || avgTurbidity > vals.MaxTurbidity
+		if opts.DryRun {
+			recordDecision(decision, database.OutcomeReward, explanation, nil)
+			continue
+		}
 
-		var actionErr error
-		if isLowQuality {
-			log.Printf("Analyzer: Low quality detected for %s. Sending email...", recorder)
-			lat, lon := database.GetRecorderLocation(recorder)
-			actionErr = sendEmail(cfg, recorder, avgPH, avgTurbidity, lat, lon)
-		} else {
-			log.Printf("Analyzer: Good quality for %s. Sending reward...", recorder)
-			actionErr = sendReward(cfg, recorder)
+		if payoutsHalted {
+			recordDecision(decision, database.OutcomeBudgetSkip, "payouts halted for this cycle", nil)
+			continue
 		}
 
-		// 4. Mark as processed if action successful
-		if actionErr == nil {
-			markProcessed(recorder)
-		} else {
-			log.Printf("Analyzer: Action failed for %s: %v", recorder, actionErr)
+		log.Printf("Analyzer: Good quality for %s. Sending reward...", recorder)
+		tx, err := sendReward(a.ctx, cycle, recorder)
+		if errors.Is(err, payout.ErrBreakerOpen) || errors.Is(err, payout.ErrCycleBudget) {
+			log.Printf("Analyzer: Stopping payouts for this cycle: %v", err)
+			payoutsHalted = true
+			recordDecision(decision, database.OutcomeBudgetSkip, "payouts halted for this cycle", err)
+			continue
+		}
+		if errors.Is(err, payout.ErrRecorderBudget) {
+			recordDecision(decision, database.OutcomeBudgetSkip, "recorder reached its payout budget", err)
+			continue
 		}
+		if err != nil {
+			recordDecision(decision, database.OutcomeFailure, "reward could not be sent", err)
+			continue
+		}
+		decision.TxHash = tx.Hash().Hex()
+
+		// 6. The reward was recorded as pending before it was sent, the confirmer
+		// marks the recorder as processed once it is mined
+		recordDecision(decision, database.OutcomeReward, fmt.Sprintf("%s (nonce %d)", explanation, tx.Nonce()), nil)
+	}
+}
+
+type analysisWindow struct {
+	start int64
+	end   int64
+}
+
+type recorderStats struct {
+	Recorder     string
+	Samples      int64
+	AvgPH        float64
+	AvgTurbidity float64
+}
+
+// policy describes the thresholds the analyzer currently applies
+func policy() string {
+	return fmt.Sprintf("pH %d-%d, turbidity <= %d, lookback %dd, cooldown %dd",
+		vals.MinPH, vals.MaxPH, vals.MaxTurbidity, vals.LookbackPeriodDays, vals.CooldownPeriodDays)
+}
+
+// evaluateQuality checks the averages against the thresholds and explains the verdict
+func evaluateQuality(stats recorderStats) (bool, string) {
+	var breaches []string
+	if stats.AvgPH < vals.MinPH {
+		breaches = append(breaches, fmt.Sprintf("average pH %.2f is below %d", stats.AvgPH, vals.MinPH))
+	}
+	if stats.AvgPH > vals.MaxPH {
+		breaches = append(breaches, fmt.Sprintf("average pH %.2f is above %d", stats.AvgPH, vals.MaxPH))
+	}
+	if stats.AvgTurbidity > vals.MaxTurbidity {
+		breaches = append(breaches, fmt.Sprintf("average turbidity %.2f is above %d", stats.AvgTurbidity, vals.MaxTurbidity))
+	}
+	if len(breaches) > 0 {
+		return true, strings.Join(breaches, "; ")
+	}
+	return false, fmt.Sprintf("average pH %.2f and turbidity %.2f over %d readings are within thresholds", stats.AvgPH, stats.AvgTurbidity, stats.Samples)
+}
+
+func newDecision(run *database.AnalyzerRun, window analysisWindow, stats recorderStats) database.Decision {
+	return database.Decision{
+		RunID:        run.ID,
+		Recorder:     stats.Recorder,
+		DryRun:       run.DryRun,
+		WindowStart:  window.start,
+		WindowEnd:    window.end,
+		SampleCount:  stats.Samples,
+		AvgPH:        stats.AvgPH,
+		AvgTurbidity: stats.AvgTurbidity,
+		Policy:       policy(),
+	}
+}
+
+// recordDecision logs and persists the outcome for a recorder
+func recordDecision(decision database.Decision, outcome, reason string, actionErr error) {
+	decision.Outcome = outcome
+	decision.Reason = reason
+	if actionErr != nil {
+		decision.Error = actionErr.Error()
+	}
+
+	prefix := "Analyzer:"
+	if decision.DryRun {
+		prefix = "Analyzer: [dry run]"
+	}
+	if actionErr != nil {
+		log.Printf("%s %s for %s: %s (%v)", prefix, outcome, decision.Recorder, reason, actionErr)
+	} else {
+		log.Printf("%s %s for %s: %s", prefix, outcome, decision.Recorder, reason)
+	}
+
+	if err := database.RecordDecision(&decision); err != nil {
+		log.Printf("Analyzer: Failed to record decision for %s: %v", decision.Recorder, err)
 	}
 }
 
@@ -162,49 +460,10 @@ func markProcessed(recorder string) {
 	}
 }
 
-func sendReward(cfg *config.Config, toAddress string) error {
-	client, err := ethclient.Dial(cfg.BlockchainURL)
-	if err != nil {
-		return err
+func sendReward(ctx context.Context, cycle *payout.Cycle, toAddress string) (*types.Transaction, error) {
+	if cycle == nil {
+		return nil, errors.New("payout service is not available")
 	}
-	defer client.Close()
-
-	privateKey, err := crypto.HexToECDSA(cfg.PrivateKey)
-	if err != nil {
-		return err
-	}
-
-	publicKey := privateKey.Public()
-	publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-	if !ok {
-		return log.Output(1, "error casting public key to ECDSA")
-	}
-
-	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
-	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
-	if err != nil {
-		return err
-	}
-
 	value := big.NewInt(vals.RewardAmount) // in wei
-	gasLimit := uint64(21000)              // in units
-	gasPrice, err := client.SuggestGasPrice(context.Background())
-	if err != nil {
-		return err
-	}
-
-	to := common.HexToAddress(toAddress)
-	tx := types.NewTransaction(nonce, to, value, gasLimit, gasPrice, nil)
-
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		return err
-	}
-
-	signedTx, err := types.SignTx(tx, types.NewEIP155Signer(chainID), privateKey)
-	if err != nil {
-		return err
-	}
-
-	return client.SendTransaction(context.Background(), signedTx)
+	return cycle.Pay(ctx, common.HexToAddress(toAddress), value)
 }
@@ -3,6 +3,7 @@ package ws
 import (
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"p2m-lite/config"
 	"p2m-lite/internal/contract"
@@ -14,15 +15,7 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins
-	},
-}
-
-func HandleLogs(c *gin.Context, cfg *config.Config) {
+func (h *Hub) HandleLogs(c *gin.Context, cfg *config.Config) {
 	recorderAddr := c.Param("Recorder")
 	var filter []common.Address
 
@@ -34,12 +27,17 @@ func HandleLogs(c *gin.Context, cfg *config.Config) {
 		filter = []common.Address{common.HexToAddress(recorderAddr)}
 	}
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade to websocket: %v", err)
 		return
 	}
 	defer conn.Close()
+	if !h.add(conn) {
+		closeGoingAway(conn)
+		return
+	}
+	defer h.remove(conn)
 
 	if strings.HasPrefix(cfg.BlockchainURL, "http") {
 		log.Printf("Error: BlockchainURL must be a WebSocket URL (ws:// or wss://) for subscriptions, got: %s", cfg.BlockchainURL)
@@ -71,6 +69,15 @@ func HandleLogs(c *gin.Context, cfg *config.Config) {
 		return
 	}
 	defer sub.Unsubscribe()
+
+	batches := make(chan *contract.P2MContractLogBatchStored)
+	batchSub, err := p2m.WatchLogBatchStored(nil, batches, filter)
+	if err != nil {
+		log.Printf("Failed to subscribe to log batches: %v", err)
+		conn.WriteJSON(gin.H{"error": "Failed to subscribe to logs"})
+		return
+	}
+	defer batchSub.Unsubscribe()
 	fmt.Println("Subscribed to log events for recorder:", recorderAddr)
 
 	// Handle client disconnect
@@ -78,6 +85,7 @@ func HandleLogs(c *gin.Context, cfg *config.Config) {
 		for {
 			if _, _, err := conn.NextReader(); err != nil {
 				sub.Unsubscribe()
+				batchSub.Unsubscribe()
 				return
 			}
 		}
@@ -85,21 +93,41 @@ func HandleLogs(c *gin.Context, cfg *config.Config) {
 
 	for {
 		select {
+		case <-h.done:
+			return
 		case err := <-sub.Err():
 			log.Printf("Subscription error: %v", err)
 			conn.WriteJSON(gin.H{"error": "Subscription error"})
 			return
+		case err := <-batchSub.Err():
+			log.Printf("Subscription error: %v", err)
+			conn.WriteJSON(gin.H{"error": "Subscription error"})
+			return
 		case vLog := <-logs:
-			err := conn.WriteJSON(gin.H{
-				"recorder":  vLog.Recorder.Hex(),
-				"phValue":   vLog.PhValue.String(),
-				"turbidity": vLog.Turbidity.String(),
-				"timestamp": vLog.Timestamp.String(),
-			})
-			if err != nil {
+			if err := writeLog(conn, vLog.Recorder, vLog.PhValue, vLog.Turbidity, vLog.Timestamp); err != nil {
 				log.Printf("Failed to write to websocket: %v", err)
 				return
 			}
+		case batch := <-batches:
+			// Clients see the readings of a batch as individual logs
+			for i := range batch.PhValues {
+				if i >= len(batch.Turbidities) || i >= len(batch.Timestamps) {
+					break
+				}
+				if err := writeLog(conn, batch.Recorder, batch.PhValues[i], batch.Turbidities[i], batch.Timestamps[i]); err != nil {
+					log.Printf("Failed to write to websocket: %v", err)
+					return
+				}
+			}
 		}
 	}
 }
+
+func writeLog(conn *websocket.Conn, recorder common.Address, ph, turbidity, timestamp *big.Int) error {
+	return conn.WriteJSON(gin.H{
+		"recorder":  recorder.Hex(),
+		"phValue":   ph.String(),
+		"turbidity": turbidity.String(),
+		"timestamp": timestamp.String(),
+	})
+}
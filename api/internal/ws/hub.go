@@ -0,0 +1,107 @@
+package ws
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"p2m-lite/internal/cors"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeTimeout bounds writing the close frame to one client
+const closeTimeout = time.Second
+
+// Hub tracks the open log streams so shutdown can tell clients and wait for them.
+// http.Server.Shutdown does not wait for upgraded connections.
+type Hub struct {
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	conns   map[*websocket.Conn]struct{}
+	closing bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewHub accepts upgrades from the origins policy allows
+func NewHub(policy *cors.Policy) *Hub {
+	return &Hub{
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     policy.CheckOrigin,
+		},
+		conns: make(map[*websocket.Conn]struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// add registers a stream, it fails once shutdown began
+func (h *Hub) add(conn *websocket.Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+func (h *Hub) remove(conn *websocket.Conn) {
+	h.mu.Lock()
+	delete(h.conns, conn)
+	h.mu.Unlock()
+	h.wg.Done()
+}
+
+// Shutdown sends every client a going-away close frame and waits until their
+// handlers returned. Connections still open when ctx is done are dropped.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	if !h.closing {
+		h.closing = true
+		close(h.done)
+	}
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mu.Unlock()
+
+	if len(conns) > 0 {
+		log.Printf("WebSocket: Closing %d log streams", len(conns))
+	}
+	for _, conn := range conns {
+		closeGoingAway(conn)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		for conn := range h.conns {
+			conn.Close()
+		}
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// closeGoingAway tells the client the server is shutting down. WriteControl may
+// run concurrently with the handler writing logs.
+func closeGoingAway(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeTimeout)); err != nil && err != websocket.ErrCloseSent {
+		log.Printf("WebSocket: Failed to send close frame: %v", err)
+	}
+}
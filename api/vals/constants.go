@@ -3,8 +3,8 @@ package vals
 import "time"
 
 const (
-	// AnalysisIntervalHours (X): How often the analyzer runs
-	AnalysisIntervalHours = 10 * time.Minute
+	// AnalysisInterval (X): How often the analyzer runs when no ANALYZER_SCHEDULE is configured
+	AnalysisInterval = 10 * time.Minute
 
 	// LookbackPeriodDays (M): How many days of logs to analyze
 	LookbackPeriodDays = 7
@@ -17,6 +17,63 @@ const (
 	MaxPH        = 9
 	MaxTurbidity = 500
 
+	// ReceiptPollInterval: How often pending reward transactions are checked for receipts
+	ReceiptPollInterval = 30 * time.Second
+
+	// StuckTxTimeout: How long a reward may stay pending before it is rebroadcast with higher fees
+	StuckTxTimeout = 5 * time.Minute
+
+	// FeeBumpPercent: Fee increase applied to replacement transactions (nodes require at least 10%)
+	FeeBumpPercent = 15
+
+	// PayoutSendAttempts: How often a payout is retried after a nonce conflict
+	PayoutSendAttempts = 3
+
+	// TransferGasLimit: Minimum gas limit of a payout (a plain value transfer)
+	TransferGasLimit = 21000
+
+	// OutboxPollInterval: How often the outbox looks for notifications to deliver
+	OutboxPollInterval = 10 * time.Second
+
+	// OutboxMaxAttempts: Deliveries after which a notification is dead-lettered
+	OutboxMaxAttempts = 8
+
+	// OutboxBaseBackoff / OutboxMaxBackoff: Retry delay doubles from base up to max
+	OutboxBaseBackoff = 30 * time.Second
+	OutboxMaxBackoff  = 1 * time.Hour
+
+	// OutboxDedupWindow: Identical notifications within this window are only sent once
+	OutboxDedupWindow = 6 * time.Hour
+
+	// IncidentEscalationAfter: Open incidents nobody acknowledged within this time are escalated
+	IncidentEscalationAfter = 12 * time.Hour
+
+	// IncidentCheckInterval: How often unacknowledged incidents are checked for escalation
+	IncidentCheckInterval = 5 * time.Minute
+
+	// DeviceOfflineAfter: Recorders without a heartbeat for this long are marked offline
+	DeviceOfflineAfter = 5 * time.Minute
+
+	// DeviceCheckInterval: How often heartbeats are checked for silent recorders
+	DeviceCheckInterval = 1 * time.Minute
+
+	// KeyRotationMaxAge: How old a signed key handover may be when it reaches the API
+	KeyRotationMaxAge = 10 * time.Minute
+
+	// RelayMaxGas: Highest gas limit a recorder may request for a relayed call (a full storeLogs batch fits)
+	RelayMaxGas = 12_500_000
+
+	// RelayBaseGas / RelayGasPerReading: A relayed call may request at most base + per reading gas,
+	// matching what the daemon asks for
+	RelayBaseGas       = 60_000
+	RelayGasPerReading = 120_000
+
+	// RelayMaxDeadline: How far in the future a relayed request may expire
+	RelayMaxDeadline = 1 * time.Hour
+
+	// RelayHourlyLimit: Relayed requests one recorder may submit per hour
+	RelayHourlyLimit = 120
+
 	// Reward Amount (in Wei)
 	RewardAmount = 250_000_000_000_000 // 0.00025 BNB (₹ 20 approx)
 )
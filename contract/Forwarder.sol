@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: SEE LICENSE IN LICENSE
+pragma solidity ^0.8.30;
+
+// Forwarder relays EIP-712 signed requests so a relayer pays the gas while the
+// target contract sees the signer as the sender (ERC-2771).
+contract Forwarder {
+  struct ForwardRequest {
+    address from;
+    address to;
+    uint256 value;
+    uint256 gas;
+    uint256 nonce;
+    uint256 deadline;
+    bytes data;
+  }
+
+  bytes32 private constant DOMAIN_TYPEHASH =
+    keccak256("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)");
+  bytes32 private constant REQUEST_TYPEHASH =
+    keccak256("ForwardRequest(address from,address to,uint256 value,uint256 gas,uint256 nonce,uint256 deadline,bytes data)");
+  // Upper half of the secp256k1 order, signatures above it are malleable
+  uint256 private constant MAX_S = 0x7FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF5D576E7357A4501DDFE92F46681B20A0;
+
+  mapping(address => uint256) private nonces;
+
+  // Only emitted for calls that succeeded, a failing call reverts the whole request
+  event Executed(address indexed from, address indexed to, uint256 nonce);
+
+  function getNonce(address from) public view returns (uint256) {
+    return nonces[from];
+  }
+
+  function domainSeparator() public view returns (bytes32) {
+    return keccak256(abi.encode(DOMAIN_TYPEHASH, keccak256("P2MForwarder"), keccak256("1"), block.chainid, address(this)));
+  }
+
+  function verify(ForwardRequest calldata req, bytes calldata signature) public view returns (bool) {
+    if (req.nonce != nonces[req.from] || block.timestamp > req.deadline) {
+      return false;
+    }
+    return recover(digest(req), signature) == req.from;
+  }
+
+  function execute(ForwardRequest calldata req, bytes calldata signature) public payable returns (bytes memory) {
+    require(msg.value == req.value, "Value does not match the request");
+    require(block.timestamp <= req.deadline, "Request expired");
+    require(req.nonce == nonces[req.from], "Invalid nonce");
+    require(recover(digest(req), signature) == req.from, "Signature does not match the request");
+
+    nonces[req.from] = req.nonce + 1;
+
+    (bool success, bytes memory result) = req.to.call{gas: req.gas, value: req.value}(abi.encodePacked(req.data, req.from));
+    // Make sure the relayer forwarded enough gas, see EIP-150
+    require(gasleft() > req.gas / 63, "Insufficient gas forwarded");
+    if (!success) {
+      assembly {
+        revert(add(result, 32), mload(result))
+      }
+    }
+
+    emit Executed(req.from, req.to, req.nonce);
+    return result;
+  }
+
+  function digest(ForwardRequest calldata req) private view returns (bytes32) {
+    bytes32 structHash = keccak256(abi.encode(
+      REQUEST_TYPEHASH,
+      req.from,
+      req.to,
+      req.value,
+      req.gas,
+      req.nonce,
+      req.deadline,
+      keccak256(req.data)
+    ));
+    return keccak256(abi.encodePacked("\x19\x01", domainSeparator(), structHash));
+  }
+
+  function recover(bytes32 hash, bytes calldata signature) private pure returns (address) {
+    if (signature.length != 65) {
+      return address(0);
+    }
+    bytes32 r = bytes32(signature[0:32]);
+    bytes32 s = bytes32(signature[32:64]);
+    uint8 v = uint8(signature[64]);
+    if (uint256(s) > MAX_S || (v != 27 && v != 28)) {
+      return address(0);
+    }
+    return ecrecover(hash, v, r, s);
+  }
+}
@@ -9,22 +9,71 @@ contract Log {
     uint256 timestamp;
   }
 
+  // Upper bound on logs per batch, keeps a batch well below the block gas limit
+  uint256 public constant MAX_BATCH_SIZE = 100;
+  // How far a device clock may run ahead of the block timestamp
+  uint256 public constant MAX_CLOCK_DRIFT = 5 minutes;
+
   WaterLog[] public waterLogs;
 
+  // Forwarder allowed to submit logs on behalf of recorders (ERC-2771), zero to disable relaying
+  address public immutable trustedForwarder;
+
   event LogStored(address indexed recorder, uint256 phValue, uint256 turbidity, uint256 timestamp);
+  event LogBatchStored(address indexed recorder, uint256[] phValues, uint256[] turbidities, uint256[] timestamps);
+
+  constructor(address _trustedForwarder) {
+    trustedForwarder = _trustedForwarder;
+  }
+
+  function isTrustedForwarder(address forwarder) public view returns (bool) {
+    return forwarder != address(0) && forwarder == trustedForwarder;
+  }
+
+  // _msgSender is the recorder: the caller, or the signer appended by the trusted forwarder
+  function _msgSender() internal view returns (address sender) {
+    if (isTrustedForwarder(msg.sender) && msg.data.length >= 20) {
+      assembly {
+        sender := shr(96, calldataload(sub(calldatasize(), 20)))
+      }
+    } else {
+      sender = msg.sender;
+    }
+  }
 
   function storeLog(uint256 _phValue, uint256 _turbidity) public {
     require(_phValue >= 0 && _phValue <= 14, "pH value must be between 0 and 14");
     require(_turbidity >= 0, "Turbidity must be non-negative");
+    address recorder = _msgSender();
     WaterLog memory newLog = WaterLog({
-      recorder: msg.sender,
+      recorder: recorder,
       phValue: _phValue,
       turbidity: _turbidity,
       timestamp: block.timestamp
     });
 
     waterLogs.push(newLog);
-    emit LogStored(msg.sender, _phValue, _turbidity, block.timestamp);
+    emit LogStored(recorder, _phValue, _turbidity, block.timestamp);
+  }
+
+  // storeLogs records several readings taken by the sender at the given times
+  function storeLogs(uint256[] calldata _phValues, uint256[] calldata _turbidities, uint256[] calldata _timestamps) public {
+    uint256 count = _phValues.length;
+    require(count > 0 && count <= MAX_BATCH_SIZE, "Batch must hold between 1 and MAX_BATCH_SIZE logs");
+    require(_turbidities.length == count && _timestamps.length == count, "Batch arrays must have the same length");
+
+    address recorder = _msgSender();
+    for (uint256 i = 0; i < count; i++) {
+      require(_phValues[i] <= 14, "pH value must be between 0 and 14");
+      require(_timestamps[i] <= block.timestamp + MAX_CLOCK_DRIFT, "Timestamp is in the future");
+      waterLogs.push(WaterLog({
+        recorder: recorder,
+        phValue: _phValues[i],
+        turbidity: _turbidities[i],
+        timestamp: _timestamps[i]
+      }));
+    }
+    emit LogBatchStored(recorder, _phValues, _turbidities, _timestamps);
   }
 
   function getLogCount() public view returns (uint256) {
@@ -4,6 +4,8 @@ pragma solidity ^0.8.30;
 import "./Log.sol";
 
 contract P2M is Log {
+  constructor(address _trustedForwarder) Log(_trustedForwarder) {}
+
   function getTimestamp() public view returns (uint256) {
     return block.timestamp;
   }
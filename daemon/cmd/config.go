@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/p2m-lite/core/daemon/internal/config"
+)
+
+const configUsage = `Usage: daemon [--config file] [--profile name] config check
+
+Loads the configuration of every given profile, reports every problem found
+and prints the settings the daemon would run with.
+`
+
+func runConfig(profiles []string, file string, args []string) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+
+	var configs []*config.Config
+	failed := false
+	for _, profile := range profiles {
+		cfg, err := config.Load(profile, file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		configs = append(configs, cfg)
+		printConfig(cfg)
+	}
+	if err := checkProfiles(configs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		failed = true
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func printConfig(cfg *config.Config) {
+	if cfg.Profile == "" {
+		fmt.Println("Configuration is valid.")
+	} else {
+		fmt.Printf("Configuration of profile %s is valid.\n", cfg.Profile)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	files := "none, environment only"
+	if len(cfg.Files) > 0 {
+		files = strings.Join(cfg.Files, ", ")
+	}
+	chainID := "any"
+	if cfg.ChainID != nil {
+		chainID = cfg.ChainID.String()
+	}
+	statusAddr := "disabled"
+	if cfg.StatusAddr != "" {
+		statusAddr = "http://" + cfg.StatusAddr
+	}
+	heartbeat := "disabled"
+	if cfg.HeartbeatInterval > 0 {
+		heartbeat = "every " + cfg.HeartbeatInterval.String()
+	}
+
+	fmt.Fprintf(w, "  Files\t%s\n", files)
+	fmt.Fprintf(w, "  API\t%s\n", cfg.APIURL)
+	fmt.Fprintf(w, "  Submit mode\t%s\n", cfg.SubmitMode)
+	fmt.Fprintf(w, "  Contract\t%s\n", cfg.ContractAddress)
+	fmt.Fprintf(w, "  RPC\t%s\n", cfg.BlockchainURL)
+	fmt.Fprintf(w, "  Chain ID\t%s\n", chainID)
+	fmt.Fprintf(w, "  Key\t%s in %s\n", cfg.Key.Storage, cfg.Key.Dir)
+	fmt.Fprintf(w, "  Sensor\t%s every %s\n", cfg.Sensor.Driver, cfg.SensorInterval)
+	fmt.Fprintf(w, "  Queue\t%s (up to %d readings, %s)\n", cfg.QueueDir, cfg.QueueMaxReadings, cfg.QueueMaxAge)
+	fmt.Fprintf(w, "  Batch\tup to %d readings, flushed every %s\n", cfg.BatchSize, cfg.BatchFlushInterval)
+	fmt.Fprintf(w, "  Heartbeat\t%s\n", heartbeat)
+	fmt.Fprintf(w, "  Status server\t%s\n", statusAddr)
+	fmt.Fprintf(w, "  Shutdown timeout\t%s\n", cfg.ShutdownTimeout)
+	w.Flush()
+	fmt.Println()
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/p2m-lite/core/daemon/internal/auth"
+	"github.com/p2m-lite/core/daemon/internal/config"
+	"github.com/p2m-lite/core/daemon/internal/key"
+	"golang.org/x/term"
+)
+
+const (
+	handoverAttempts   = 3
+	handoverRetryDelay = 2 * time.Second
+)
+
+const keyUsage = `Usage: daemon key <command> [flags]
+
+Commands:
+  show        Print the address and public key of the device key
+  import      Replace the device key with an existing one (hex, PEM, keystore JSON or mnemonic)
+  export      Write the device key as hex, PEM or keystore JSON
+  rotate      Switch to a new key and hand the recorder over to it
+  sign-test   Check that the key signs correctly and is accepted by the API
+
+Run "daemon key <command> -h" for the flags of a command.
+`
+
+func runKey(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keyUsage)
+		return 2
+	}
+
+	km, err := key.NewManager(cfg.Key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "show":
+		err = keyShow(km)
+	case "import":
+		err = keyImport(km, args[1:])
+	case "export":
+		err = keyExport(km, args[1:])
+	case "rotate":
+		err = keyRotate(cfg, km)
+	case "sign-test":
+		err = keySignTest(cfg, km, args[1:])
+	default:
+		fmt.Fprint(os.Stderr, keyUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+func requireKey(km *key.Manager) error {
+	if !km.HasKey() {
+		return fmt.Errorf("no device key in %s yet, start the daemon once or run \"key import\"", km.Dir())
+	}
+	return nil
+}
+
+func keyShow(km *key.Manager) error {
+	if err := requireKey(km); err != nil {
+		return err
+	}
+	address, err := km.Address()
+	if err != nil {
+		return err
+	}
+	publicKey, err := km.GetPublicKeyPEM()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Address:  %s\n", address.Hex())
+	fmt.Printf("Storage:  %s (%s)\n", km.Storage(), km.Dir())
+	fmt.Printf("Public key:\n%s", publicKey)
+	return nil
+}
+
+func keyImport(km *key.Manager, args []string) error {
+	fs := flag.NewFlagSet("key import", flag.ContinueOnError)
+	format := fs.String("format", key.FormatAuto, "hex, pem, keystore, mnemonic or auto")
+	path := fs.String("path", key.DefaultDerivationPath, "BIP-32 derivation path of a mnemonic")
+	passphraseFile := fs.String("passphrase-file", "", "file with the keystore passphrase or the BIP-39 passphrase")
+	force := fs.Bool("force", false, "replace an existing device key, which is archived")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: daemon key import [flags] [file]\n\nReads the key from file, or from stdin when no file is given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	data, err := readInput(fs.Arg(0), "Paste the key or mnemonic, then press Ctrl-D:")
+	if err != nil {
+		return err
+	}
+
+	opts := key.ImportOptions{Path: *path}
+	detected := *format
+	if detected == key.FormatAuto {
+		detected = key.DetectFormat(data)
+	}
+	if *passphraseFile != "" {
+		b, err := os.ReadFile(*passphraseFile)
+		if err != nil {
+			return fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		opts.Passphrase = strings.TrimRight(string(b), "\r\n")
+	} else if detected == key.FormatKeystore {
+		if opts.Passphrase, err = key.ReadSecret("Passphrase of the imported keystore: "); err != nil {
+			return fmt.Errorf("keystore passphrase needed, use -passphrase-file: %w", err)
+		}
+	}
+
+	imported, err := key.Parse(detected, data, opts)
+	if err != nil {
+		return err
+	}
+	archived, err := km.Store(imported, *force)
+	if errors.Is(err, key.ErrKeyExists) {
+		return fmt.Errorf("%w, pass -force to replace it (the old key is archived)", err)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %s key %s.\n", detected, crypto.PubkeyToAddress(imported.PublicKey).Hex())
+	if archived != "" {
+		fmt.Printf("The previous key was moved to %s.\n", archived)
+	}
+	return nil
+}
+
+func keyExport(km *key.Manager, args []string) error {
+	fs := flag.NewFlagSet("key export", flag.ContinueOnError)
+	format := fs.String("format", key.FormatKeystore, "hex, pem or keystore")
+	out := fs.String("out", "", "file to write, stdout when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireKey(km); err != nil {
+		return err
+	}
+
+	data, err := km.Export(*format)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		if *format != key.FormatKeystore {
+			fmt.Fprintln(os.Stderr, "Warning: This is the unencrypted private key. Anyone who sees it controls the recorder.")
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *out, err)
+	}
+	fmt.Printf("Key written to %s.\n", *out)
+	return nil
+}
+
+func keyRotate(cfg *config.Config, km *key.Manager) error {
+	if err := requireKey(km); err != nil {
+		return err
+	}
+	oldKey, err := km.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	newKey, err := crypto.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	from, to := crypto.PubkeyToAddress(oldKey.PublicKey), crypto.PubkeyToAddress(newKey.PublicKey)
+
+	fmt.Printf("Authenticating new key %s...\n", to.Hex())
+	newAuth := auth.NewService(cfg.AuthURL, cfg.VerifyURL, key.Static{Key: newKey})
+	if err := newAuth.Login(); err != nil {
+		return fmt.Errorf("the API did not accept the new key: %w", err)
+	}
+
+	archived, err := km.Store(newKey, true)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Handing recorder %s over to %s...\n", from.Hex(), to.Hex())
+	if err := handover(newAuth, cfg.RotateURL, oldKey); err != nil {
+		replaced, rErr := km.Restore(archived)
+		if rErr != nil {
+			return fmt.Errorf("handover failed: %w (restoring the old key failed too: %v, it is in %s)", err, rErr, archived)
+		}
+		return fmt.Errorf("handover failed, the old key stays in use and the new key %s is archived in %s; "+
+			"if the API did take over the recorder, import it from there with key import -force: %w", to.Hex(), replaced, err)
+	}
+
+	fmt.Printf("Rotated %s to %s. The old key is archived in %s.\n", from.Hex(), to.Hex(), archived)
+	fmt.Println("Restart the daemon to use the new key. Logs already on chain stay with the old address.")
+	return nil
+}
+
+// handover hands the recorder over to the new key. The API accepts the same handover
+// again, so attempts whose answer got lost are simply repeated.
+func handover(newAuth *auth.Service, url string, oldKey *ecdsa.PrivateKey) error {
+	var err error
+	for attempt := 1; attempt <= handoverAttempts; attempt++ {
+		if err = newAuth.Handover(url, oldKey); err == nil {
+			return nil
+		}
+		if attempt < handoverAttempts {
+			fmt.Printf("Handover attempt %d failed: %v, retrying...\n", attempt, err)
+			time.Sleep(handoverRetryDelay)
+		}
+	}
+	return err
+}
+
+func keySignTest(cfg *config.Config, km *key.Manager, args []string) error {
+	fs := flag.NewFlagSet("key sign-test", flag.ContinueOnError)
+	offline := fs.Bool("offline", false, "only check signing locally, do not authenticate with the API")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireKey(km); err != nil {
+		return err
+	}
+
+	privKey, err := km.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	address := crypto.PubkeyToAddress(privKey.PublicKey)
+
+	message := fmt.Sprintf("P2M sign test %d", time.Now().Unix())
+	signature, err := auth.SignMessage(privKey, message)
+	if err != nil {
+		return fmt.Errorf("failed to sign: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] -= 27
+	publicKey, err := crypto.SigToPub(accounts.TextHash([]byte(message)), signature)
+	if err != nil || crypto.PubkeyToAddress(*publicKey) != address {
+		return errors.New("signature does not recover to the device address")
+	}
+	fmt.Printf("Local signature OK for %s.\n", address.Hex())
+
+	if *offline {
+		return nil
+	}
+	if err := auth.NewService(cfg.AuthURL, cfg.VerifyURL, km).Login(); err != nil {
+		return fmt.Errorf("the API rejected the key: %w", err)
+	}
+	fmt.Println("API accepted the key.")
+	return nil
+}
+
+// readInput reads a file, or stdin when path is empty or "-"
+func readInput(path, hint string) ([]byte, error) {
+	if path != "" && path != "-" {
+		return os.ReadFile(path)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+	return io.ReadAll(os.Stdin)
+}
@@ -1,88 +1,211 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/p2m-lite/core/daemon/internal/auth"
 	"github.com/p2m-lite/core/daemon/internal/config"
-	"github.com/p2m-lite/core/daemon/internal/key"
-	"github.com/p2m-lite/core/daemon/internal/web3"
+	"github.com/p2m-lite/core/daemon/internal/status"
 )
 
-func main() {
-	log.Println("Starting P2M Lite Daemon...")
+// shutdownGrace is added to the longest ShutdownTimeout for closing queues and
+// servers before the process exits regardless
+const shutdownGrace = 5 * time.Second
 
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+// Version is reported as the firmware in heartbeats, set it with -ldflags "-X main.Version=..."
+var Version = "dev"
+
+const usage = `Usage: daemon [--config file] [--profile name[,name...]] [command]
+
+Without a command the daemon records readings for every given profile.
+Profiles default to $P2M_PROFILE, or the default profile when that is unset.
+
+Commands:
+  config check   Validate the configuration and print the effective settings
+  key            Manage the device key, see "daemon key"
+
+Flags:
+`
+
+func main() {
+	var profiles profileList
+	configFile := flag.String("config", "", "YAML config file, defaults to $P2M_CONFIG or p2m-lite/daemon.yaml in the user config directory")
+	flag.Var(&profiles, "profile", "profile to use, repeat or separate with commas to run several")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if len(profiles) == 0 {
+		profiles.Set(os.Getenv("P2M_PROFILE"))
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfig(profiles, *configFile, args[1:]))
 	}
-	log.Printf("Configuration loaded. Auth URL: %s", cfg.AuthURL)
 
-	keyManager, err := key.NewManager()
-	if err != nil {
-		log.Fatalf("Failed to initialize key manager: %v", err)
+	configs := make([]*config.Config, len(profiles))
+	for i, profile := range profiles {
+		cfg, err := config.Load(profile, *configFile)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		configs[i] = cfg
 	}
 
-	log.Println("Ensuring keys exist...")
-	if err := keyManager.EnsureKeys(); err != nil {
-		log.Fatalf("Failed to ensure keys: %v", err)
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "key":
+			if len(configs) > 1 {
+				log.Fatal("Key commands work on one profile at a time")
+			}
+			os.Exit(runKey(configs[0], args[1:]))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", args[0])
+			flag.Usage()
+			os.Exit(2)
+		}
 	}
-	log.Println("Keys ensured.")
 
-	authService := auth.NewService()
+	if err := checkProfiles(configs); err != nil {
+		log.Fatalf("Invalid profiles: %v", err)
+	}
 
-	if err := performAuth(cfg, keyManager, authService); err != nil {
-		log.Fatalf("Authentication failed: %v", err)
+	log.Println("Starting P2M Lite Daemon...")
+	recorders := make([]*recorder, len(configs))
+	for i, cfg := range configs {
+		log.Printf("Configuration loaded. Profile: %q, Auth URL: %s", cfg.Profile, cfg.AuthURL)
+		r, err := newRecorder(cfg)
+		if err != nil {
+			log.Fatalf("Failed to start profile %q: %v", cfg.Profile, err)
+		}
+		recorders[i] = r
 	}
 
-	privKey, kErr := keyManager.GetPrivateKey()
-	if kErr != nil {
-		log.Fatalf("Failed to get private key: %v", kErr)
+	servers, err := startStatusServers(recorders)
+	if err != nil {
+		log.Fatalf("Failed to start status server: %v", err)
 	}
 
-	log.Println("Daemon is looping in background...")
-	for {
-		time.Sleep(10 * time.Second)
-		// Generate a random ph value and turbidity for demo purposes
-		ph := 7 + time.Now().Second()%3       // Example: 7, 8, or 9
-		turbidity := 300 + time.Now().Second()%100 // Example: 300-399
-		err := web3.SendLog(cfg.ContractAddress, privKey, ph, turbidity)
+	// SIGINT or SIGTERM stop the recorders, a second signal kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() {
+		stop()
+		time.AfterFunc(shutdownTimeout(configs)+shutdownGrace, func() {
+			log.Fatal("Shutdown timed out")
+		})
+	})
+
+	if len(recorders) == 1 {
+		err := recorders[0].run(ctx)
+		stopStatusServers(servers)
 		if err != nil {
-			log.Printf("Failed to send log to blockchain: %v", err)
-			continue
+			log.Fatal(err)
 		}
-		
-		log.Println("Log sent to blockchain.")
+		log.Println("Daemon stopped")
+		return
+	}
+
+	// A failing profile does not take the others down
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for _, r := range recorders {
+		wg.Go(func() {
+			if err := r.run(ctx); err != nil {
+				r.log.Printf("Profile stopped: %v", err)
+				failed.Add(1)
+			}
+		})
 	}
+	wg.Wait()
+	stopStatusServers(servers)
+	if ctx.Err() == nil {
+		log.Fatalf("All %d profiles stopped", failed.Load())
+	}
+	log.Println("Daemon stopped")
 }
 
-func performAuth(cfg *config.Config, km *key.Manager, as *auth.Service) error {
-	// Step 2: Initiate Challenge
-	log.Println("Initiating Auth Challenge...")
-	pubKeyPEM, err := km.GetPublicKeyPEM()
-	if err != nil {
-		return err
+// shutdownTimeout is the longest ShutdownTimeout of the profiles
+func shutdownTimeout(configs []*config.Config) time.Duration {
+	var timeout time.Duration
+	for _, cfg := range configs {
+		timeout = max(timeout, cfg.ShutdownTimeout)
 	}
+	return timeout
+}
 
-	challenge, keyData, err := as.InitiateChallenge(cfg.AuthURL, pubKeyPEM)
-	if err != nil {
-		return err
+// profileList collects --profile values, which may be repeated or comma separated
+type profileList []string
+
+func (p *profileList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *profileList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		*p = append(*p, strings.TrimSpace(name))
 	}
-	log.Println("Challenge received.")
+	return nil
+}
 
-	// Step 3: Verify Auth
-	log.Println("Verifying Auth...")
-	privKey, err := km.GetPrivateKey()
-	if err != nil {
-		return err
+// checkProfiles refuses profiles that would share a key or a queue, since
+// two recorders writing the same files corrupt each other
+func checkProfiles(configs []*config.Config) error {
+	keyDirs := make(map[string]string)
+	queueDirs := make(map[string]string)
+	for _, cfg := range configs {
+		keyDir, queueDir := filepath.Clean(cfg.Key.Dir), filepath.Clean(cfg.QueueDir)
+		if other, ok := keyDirs[keyDir]; ok {
+			return fmt.Errorf("profiles %q and %q share the key directory %s", other, cfg.Profile, keyDir)
+		}
+		if other, ok := queueDirs[queueDir]; ok {
+			return fmt.Errorf("profiles %q and %q share the queue directory %s", other, cfg.Profile, queueDir)
+		}
+		keyDirs[keyDir], queueDirs[queueDir] = cfg.Profile, cfg.Profile
 	}
+	return nil
+}
 
-	token, err := as.VerifyAuth(cfg.VerifyURL, privKey, challenge, keyData)
-	if err != nil {
-		return err
+// startStatusServers serves each status address with the profiles configured for it
+func startStatusServers(recorders []*recorder) ([]*status.Server, error) {
+	byAddr := make(map[string][]status.Recorder)
+	var addrs []string
+	for _, r := range recorders {
+		if r.cfg.StatusAddr == "" {
+			continue
+		}
+		if _, ok := byAddr[r.cfg.StatusAddr]; !ok {
+			addrs = append(addrs, r.cfg.StatusAddr)
+		}
+		byAddr[r.cfg.StatusAddr] = append(byAddr[r.cfg.StatusAddr], r)
 	}
+	servers := make([]*status.Server, 0, len(addrs))
+	for _, addr := range addrs {
+		server := status.NewServer(addr, Version, byAddr[addr])
+		if err := server.Start(); err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
 
-	log.Printf("Authentication successful! Session Token: %s...", token[:10]) // Log first 10 chars
-	return nil
+func stopStatusServers(servers []*status.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Status: Failed to shut down: %v", err)
+		}
+	}
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/p2m-lite/core/daemon/internal/auth"
+	"github.com/p2m-lite/core/daemon/internal/config"
+	"github.com/p2m-lite/core/daemon/internal/heartbeat"
+	"github.com/p2m-lite/core/daemon/internal/key"
+	"github.com/p2m-lite/core/daemon/internal/queue"
+	"github.com/p2m-lite/core/daemon/internal/sensor"
+	"github.com/p2m-lite/core/daemon/internal/status"
+	"github.com/p2m-lite/core/daemon/internal/web3"
+)
+
+// recorder is one profile: a device key, its session, sensor and reading queue
+type recorder struct {
+	cfg       *config.Config
+	log       *log.Logger
+	privKey   *ecdsa.PrivateKey
+	address   common.Address
+	auth      *auth.Service
+	readings  *queue.Queue
+	startedAt time.Time
+
+	// Exactly one of these submits readings, depending on the submit mode
+	chain   *web3.Logger
+	relayer *web3.Relayer
+
+	// Activity shown by the status server and heartbeats
+	lastReading   atomic.Pointer[sensor.Reading]
+	lastTx        atomic.Pointer[status.Tx]
+	lastSubmitErr atomic.Pointer[string]
+	taken         atomic.Uint64
+	sensorErrors  atomic.Uint64
+	submitted     atomic.Uint64
+	submitErrors  atomic.Uint64
+}
+
+// newRecorder loads or creates the key of a profile and opens its queue. Keys are
+// unlocked one profile at a time so passphrase prompts do not interleave.
+func newRecorder(cfg *config.Config) (*recorder, error) {
+	logger := log.Default()
+	if cfg.Profile != "" {
+		logger = log.New(log.Writer(), "["+cfg.Profile+"] ", log.Flags()|log.Lmsgprefix)
+	}
+
+	keyManager, err := key.NewManager(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize key manager: %w", err)
+	}
+
+	logger.Printf("Ensuring keys exist in %s...", cfg.Key.Dir)
+	if err := keyManager.EnsureKeys(); err != nil {
+		return nil, fmt.Errorf("failed to ensure keys: %w", err)
+	}
+	privKey, err := keyManager.GetPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get private key: %w", err)
+	}
+	logger.Println("Keys ensured.")
+
+	readings, err := queue.Open(cfg.QueueDir, queue.Limits{
+		MaxReadings: cfg.QueueMaxReadings,
+		MaxAge:      cfg.QueueMaxAge,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open reading queue: %w", err)
+	}
+	if stats := readings.Stats(); stats.Depth > 0 {
+		logger.Printf("Resuming with %d queued readings", stats.Depth)
+	}
+
+	r := &recorder{
+		cfg:       cfg,
+		log:       logger,
+		privKey:   privKey,
+		address:   crypto.PubkeyToAddress(privKey.PublicKey),
+		auth:      auth.NewService(cfg.AuthURL, cfg.VerifyURL, keyManager),
+		readings:  readings,
+		startedAt: time.Now(),
+	}
+
+	if cfg.SubmitMode == config.SubmitRelay {
+		r.relayer = web3.NewRelayer(cfg.RelayNonceURL, cfg.RelayLogsURL, cfg.RelayRequestsURL, cfg.ChainID)
+		return r, nil
+	}
+	network := web3.Network{RPCURL: cfg.BlockchainURL, ChainID: cfg.ChainID}
+	fees := web3.FeeOptions{
+		MaxFeePerGas:     cfg.MaxFeePerGas,
+		MaxTipPerGas:     cfg.MaxTipPerGas,
+		GasMarginPercent: cfg.GasLimitMargin,
+	}
+	if r.chain, err = web3.NewLogger(network, cfg.ContractAddress, privKey, fees); err != nil {
+		readings.Close()
+		return nil, fmt.Errorf("failed to set up the blockchain client: %w", err)
+	}
+	return r, nil
+}
+
+// run samples the sensor and submits readings until ctx is cancelled, which
+// returns nil, or a fatal error occurs. A send in flight when ctx is cancelled
+// gets ShutdownTimeout to finish before it is abandoned; its readings stay queued.
+func (r *recorder) run(ctx context.Context) error {
+	defer func() {
+		if err := r.readings.Close(); err != nil {
+			r.log.Printf("Failed to close reading queue: %v", err)
+		}
+	}()
+	if r.chain != nil {
+		defer r.chain.Close()
+	}
+
+	r.log.Println("Authenticating...")
+	if err := r.auth.Login(); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	go r.auth.KeepFresh(ctx)
+
+	probe, err := sensor.New(r.cfg.Sensor)
+	if err != nil {
+		return fmt.Errorf("failed to open sensor: %w", err)
+	}
+	defer probe.Close()
+	if r.cfg.Sensor.Driver == "" || r.cfg.Sensor.Driver == sensor.DriverSimulator {
+		r.log.Println("Warning: Using the simulated sensor. Set SENSOR_DRIVER to read a real probe.")
+	}
+
+	if r.cfg.HeartbeatInterval > 0 {
+		reporter := heartbeat.NewReporter(r.cfg.HeartbeatURL, r.auth, func() heartbeat.Status {
+			status := heartbeat.Status{
+				Firmware:      Version,
+				QueueDepth:    r.readings.Stats().Depth,
+				UptimeSeconds: int64(time.Since(r.startedAt).Seconds()),
+			}
+			if reading := r.lastReading.Load(); reading != nil {
+				status.LastReading = &heartbeat.Reading{
+					PH:        reading.PH.Value,
+					Turbidity: reading.Turbidity.Value,
+					Timestamp: reading.Timestamp.Unix(),
+				}
+			}
+			return status
+		})
+		go reporter.Run(ctx, r.cfg.HeartbeatInterval)
+	}
+
+	if r.relayer != nil {
+		r.log.Println("Readings are signed and submitted through the API relay.")
+	} else {
+		if err := r.chain.Health(ctx); err != nil {
+			r.log.Printf("Warning: %v. Readings are queued until it is reachable.", err)
+		}
+		go r.chain.Watch(ctx, web3.HealthInterval)
+	}
+
+	batching := queue.Batching{Size: r.cfg.BatchSize, FlushInterval: r.cfg.BatchFlushInterval}
+	if r.cfg.BatchSize > 1 {
+		r.log.Printf("Batching up to %d readings per transaction, flushed every %s", r.cfg.BatchSize, r.cfg.BatchFlushInterval)
+	}
+	// Draining stops with ctx, but a send in flight keeps sendCtx until the timeout
+	sendCtx, cancelSend := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSend()
+	stopSends := context.AfterFunc(ctx, func() {
+		time.AfterFunc(r.cfg.ShutdownTimeout, cancelSend)
+	})
+	defer stopSends()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		r.readings.Drain(ctx, batching, func(batch []sensor.Reading) error {
+			return r.submit(sendCtx, batch)
+		})
+	}()
+
+	r.log.Println("Daemon is looping in background...")
+	ticker := time.NewTicker(r.cfg.SensorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Printf("Stopping, waiting up to %s for readings being sent...", r.cfg.ShutdownTimeout)
+			<-drained
+			if stats := r.readings.Stats(); stats.Depth > 0 {
+				r.log.Printf("%d readings stay queued for the next start", stats.Depth)
+			}
+			return nil
+		case <-ticker.C:
+		}
+
+		readCtx, cancel := context.WithTimeout(ctx, r.cfg.SensorInterval)
+		reading, err := probe.Read(readCtx)
+		cancel()
+		if ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			r.sensorErrors.Add(1)
+			r.log.Printf("Failed to read sensor: %v", err)
+			continue
+		}
+		if err := reading.Validate(); err != nil {
+			r.sensorErrors.Add(1)
+			r.log.Printf("Discarding reading: %v", err)
+			continue
+		}
+		r.lastReading.Store(&reading)
+		r.taken.Add(1)
+
+		// Readings are stored before they are sent so an outage cannot lose them
+		if err := r.readings.Push(reading); err != nil {
+			r.log.Printf("Failed to queue reading: %v", err)
+			continue
+		}
+		stats := r.readings.Stats()
+		r.log.Printf("Reading at %s: pH %.2f %s, turbidity %.2f %s (queue depth %d, dropped %d)", reading.Timestamp.Format(time.RFC3339),
+			reading.PH.Value, reading.PH.Unit, reading.Turbidity.Value, reading.Turbidity.Unit, stats.Depth, stats.Dropped)
+	}
+}
+
+// submit sends a batch of queued readings and records the outcome for status reports
+func (r *recorder) submit(ctx context.Context, batch []sensor.Reading) error {
+	txHash, err := r.send(ctx, batch)
+	if err != nil {
+		msg := err.Error()
+		r.lastSubmitErr.Store(&msg)
+		r.submitErrors.Add(1)
+		// The contract rejects the same readings again however often they are sent
+		var revert *web3.RevertError
+		if errors.As(err, &revert) {
+			return fmt.Errorf("%w: %w", queue.ErrRejected, err)
+		}
+		return err
+	}
+	r.lastSubmitErr.Store(nil)
+	r.submitted.Add(uint64(len(batch)))
+	r.lastTx.Store(&status.Tx{Hash: txHash.Hex(), Readings: len(batch), At: time.Now()})
+	return nil
+}
+
+func (r *recorder) send(ctx context.Context, batch []sensor.Reading) (common.Hash, error) {
+	// The contract stores whole numbers
+	ph := make([]int, len(batch))
+	turbidity := make([]int, len(batch))
+	timestamps := make([]time.Time, len(batch))
+	for i, reading := range batch {
+		ph[i] = int(math.Round(reading.PH.Value))
+		turbidity[i] = int(math.Round(reading.Turbidity.Value))
+		timestamps[i] = reading.Timestamp
+	}
+	// storeLog stamps a reading with the block time, which is only right for one taken
+	// just now. Readings replayed from the queue keep their own time through storeLogs.
+	batched := r.cfg.BatchSize > 1 || len(batch) > 1 || time.Since(timestamps[0]) > r.cfg.SensorInterval
+
+	if r.relayer != nil {
+		relay := func(token string) (common.Hash, error) {
+			if batched {
+				return r.relayer.SendLogs(ctx, r.cfg.ContractAddress, token, r.privKey, ph, turbidity, timestamps)
+			}
+			return r.relayer.SendLog(ctx, r.cfg.ContractAddress, token, r.privKey, ph[0], turbidity[0])
+		}
+		token, err := r.auth.Token()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		txHash, err := relay(token)
+		if errors.Is(err, web3.ErrUnauthorized) {
+			// The session was revoked or expired early, sign in again and retry once
+			r.auth.Invalidate(token)
+			if token, err = r.auth.Token(); err != nil {
+				return common.Hash{}, err
+			}
+			txHash, err = relay(token)
+		}
+		if err != nil {
+			return common.Hash{}, err
+		}
+		r.log.Printf("%d logs relayed in %s.", len(batch), txHash.Hex())
+		return txHash, nil
+	}
+
+	if batched {
+		receipt, err := r.chain.SendLogs(ctx, ph, turbidity, timestamps)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		r.log.Printf("Batch of %d logs stored in block %s.", len(batch), receipt.BlockNumber)
+		return receipt.TxHash, nil
+	}
+
+	receipt, err := r.chain.SendLog(ctx, ph[0], turbidity[0])
+	if err != nil {
+		return common.Hash{}, err
+	}
+	r.log.Printf("Log from %s stored in block %s.", timestamps[0].Format(time.RFC3339), receipt.BlockNumber)
+	return receipt.TxHash, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+
+	"github.com/p2m-lite/core/daemon/internal/status"
+)
+
+// Status implements status.Recorder
+func (r *recorder) Status(ctx context.Context) status.Snapshot {
+	s := status.Snapshot{
+		Profile:           r.cfg.Profile,
+		Address:           r.address.Hex(),
+		SubmitMode:        r.cfg.SubmitMode,
+		LastTx:            r.lastTx.Load(),
+		ReadingsTaken:     r.taken.Load(),
+		SensorErrors:      r.sensorErrors.Load(),
+		ReadingsSubmitted: r.submitted.Load(),
+		SubmitErrors:      r.submitErrors.Load(),
+	}
+
+	session := r.auth.Session()
+	s.Authenticated = session.Authenticated
+	if !session.ExpiresAt.IsZero() {
+		s.SessionExpiresAt = &session.ExpiresAt
+	}
+	if session.LastError != nil {
+		s.AuthError = session.LastError.Error()
+	}
+
+	if reading := r.lastReading.Load(); reading != nil {
+		s.LastReading = &status.Reading{
+			PH:            reading.PH.Value,
+			PHUnit:        reading.PH.Unit,
+			Turbidity:     reading.Turbidity.Value,
+			TurbidityUnit: reading.Turbidity.Unit,
+			Timestamp:     reading.Timestamp,
+		}
+	}
+	if msg := r.lastSubmitErr.Load(); msg != nil {
+		s.LastSubmitError = *msg
+	}
+
+	stats := r.readings.Stats()
+	s.Queue = status.Queue{Depth: stats.Depth, Dropped: stats.Dropped}
+	if !stats.Oldest.IsZero() {
+		s.Queue.Oldest = &stats.Oldest
+	}
+
+	if r.chain != nil {
+		s.RPC = &status.RPC{}
+		// Fetching the balance also reconnects, so it comes before the state
+		if balance, err := r.chain.Balance(ctx); err != nil {
+			s.RPC.BalanceError = err.Error()
+		} else {
+			s.RPC.BalanceWei = balance.String()
+		}
+		connected, chainID, err := r.chain.State()
+		s.RPC.Connected = connected
+		if chainID != nil {
+			s.RPC.ChainID = chainID.String()
+		}
+		if err != nil && !connected {
+			s.RPC.Error = err.Error()
+		}
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// HandoverMessage is the text the old key signs (EIP-191) to pass its recorder to a new key.
+// It must match the API.
+func HandoverMessage(from, to common.Address, signedAt int64) string {
+	return fmt.Sprintf("P2M key rotation\nRecorder: %s\nNew key: %s\nSigned at: %d", from.Hex(), to.Hex(), signedAt)
+}
+
+// SignMessage personal-signs message the way wallets do, with v = 27/28
+func SignMessage(key *ecdsa.PrivateKey, message string) ([]byte, error) {
+	signature, err := crypto.Sign(accounts.TextHash([]byte(message)), key)
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// Handover asks the API to move the recorder registered to oldKey over to the key this
+// service signs in with. The request is authenticated by the new key's session and the
+// old key's signature.
+func (s *Service) Handover(url string, oldKey *ecdsa.PrivateKey) error {
+	newKey, err := s.keys.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	token, err := s.Token()
+	if err != nil {
+		return err
+	}
+
+	from, to := crypto.PubkeyToAddress(oldKey.PublicKey), crypto.PubkeyToAddress(newKey.PublicKey)
+	signedAt := time.Now().Unix()
+	signature, err := SignMessage(oldKey, HandoverMessage(from, to, signedAt))
+	if err != nil {
+		return fmt.Errorf("failed to sign handover: %w", err)
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"from":      from.Hex(),
+		"signed_at": signedAt,
+		"signature": hexutil.Encode(signature),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned error status: %s, body: %s", resp.Status, string(body))
+	}
+	return nil
+}
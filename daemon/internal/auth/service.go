@@ -2,6 +2,7 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
@@ -9,20 +10,166 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultSessionTTL is assumed when the API does not say when a session expires
+	DefaultSessionTTL = 10 * time.Minute
+	// minRefreshLead is how long before expiry a session is renewed at the latest
+	minRefreshLead = 30 * time.Second
+	// refreshRetryDelay is the pause after a failed renewal
+	refreshRetryDelay = 30 * time.Second
+)
+
+// KeySource provides the device key the daemon signs in with
+type KeySource interface {
+	GetPublicKeyPEM() (string, error)
+	GetPrivateKey() (*ecdsa.PrivateKey, error)
+}
+
+// Service signs the daemon in and keeps its session token valid for API calls
 type Service struct {
-	client *http.Client
+	client    *http.Client
+	authURL   string
+	verifyURL string
+	keys      KeySource
+
+	mu        sync.Mutex
+	token     string
+	issuedAt  time.Time
+	expiresAt time.Time
+	loginErr  error
 }
 
-func NewService() *Service {
+// Session describes the current session for status reports
+type Session struct {
+	Authenticated bool
+	ExpiresAt     time.Time
+	// LastError is why the latest sign-in failed, nil after a successful one
+	LastError error
+}
+
+func NewService(authURL, verifyURL string, keys KeySource) *Service {
 	return &Service{
-		client: &http.Client{Timeout: 10 * time.Second},
+		client:    &http.Client{Timeout: 10 * time.Second},
+		authURL:   authURL,
+		verifyURL: verifyURL,
+		keys:      keys,
 	}
 }
 
+// Login runs the challenge flow and keeps the issued session
+func (s *Service) Login() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.login()
+}
+
+// Token returns a valid session token, signing in again when the current one
+// expired or is about to
+func (s *Service) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == "" || !time.Now().Before(s.refreshAt()) {
+		if err := s.login(); err != nil {
+			return "", err
+		}
+	}
+	return s.token, nil
+}
+
+// Invalidate forgets a token the API rejected so the next Token call signs in again.
+// A token that was already replaced is left alone.
+func (s *Service) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+func (s *Service) Session() Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Session{
+		Authenticated: s.token != "" && time.Now().Before(s.expiresAt),
+		ExpiresAt:     s.expiresAt,
+		LastError:     s.loginErr,
+	}
+}
+
+// KeepFresh renews the session ahead of its expiry until ctx is cancelled
+func (s *Service) KeepFresh(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		wait := time.Until(s.refreshAt())
+		if s.token == "" {
+			wait = 0
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if err := s.Login(); err != nil {
+			log.Printf("Failed to renew session, retrying in %s: %v", refreshRetryDelay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(refreshRetryDelay):
+			}
+		}
+	}
+}
+
+// refreshAt is when the session should be renewed: after four fifths of its lifetime,
+// but at least minRefreshLead before it expires unless the session is very short
+func (s *Service) refreshAt() time.Time {
+	lifetime := s.expiresAt.Sub(s.issuedAt)
+	lead := min(max(lifetime/5, minRefreshLead), lifetime/2)
+	return s.expiresAt.Add(-lead)
+}
+
+func (s *Service) login() error {
+	s.loginErr = s.signIn()
+	return s.loginErr
+}
+
+func (s *Service) signIn() error {
+	pubKeyPEM, err := s.keys.GetPublicKeyPEM()
+	if err != nil {
+		return err
+	}
+	challenge, keyData, err := s.InitiateChallenge(s.authURL, pubKeyPEM)
+	if err != nil {
+		return err
+	}
+
+	privKey, err := s.keys.GetPrivateKey()
+	if err != nil {
+		return err
+	}
+	issuedAt := time.Now()
+	token, expiresAt, err := s.VerifyAuth(s.verifyURL, privKey, challenge, keyData)
+	if err != nil {
+		return err
+	}
+	if expiresAt.IsZero() {
+		expiresAt = issuedAt.Add(DefaultSessionTTL)
+	}
+
+	s.token, s.issuedAt, s.expiresAt = token, issuedAt, expiresAt
+	log.Printf("Authenticated. Session valid until %s", expiresAt.Format(time.RFC3339))
+	return nil
+}
+
 func (s *Service) InitiateChallenge(url string, publicKeyPEM string) (string, string, error) {
 	reqPayload := map[string]string{
 		"public_key": publicKeyPEM,
@@ -60,13 +207,15 @@ func (s *Service) InitiateChallenge(url string, publicKeyPEM string) (string, st
 	return responseData.Challenge, responseData.KeyData, nil
 }
 
-func (s *Service) VerifyAuth(url string, privateKey *ecdsa.PrivateKey, challenge string, keyData string) (string, error) {
+// VerifyAuth answers the challenge and returns the session token with its expiry,
+// which is zero when the API does not report it
+func (s *Service) VerifyAuth(url string, privateKey *ecdsa.PrivateKey, challenge string, keyData string) (string, time.Time, error) {
 	challengeBytes := []byte(challenge)
 	hashed := sha256.Sum256(challengeBytes)
 
 	r, rs, err := ecdsa.Sign(rand.Reader, privateKey, hashed[:])
 	if err != nil {
-		return "", fmt.Errorf("failed to sign challenge: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to sign challenge: %w", err)
 	}
 
 	const keyBytes = 32
@@ -85,32 +234,36 @@ func (s *Service) VerifyAuth(url string, privateKey *ecdsa.PrivateKey, challenge
 	}
 	b, err := json.Marshal(reqPayload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON payload: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to marshal JSON payload: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to server: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to connect to server: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("server returned error status: %s, body: %s", resp.Status, string(body))
+		return "", time.Time{}, fmt.Errorf("server returned error status: %s, body: %s", resp.Status, string(body))
 	}
 
 	var responseData struct {
 		SessionToken string `json:"session_token"`
+		ExpiresAt    int64  `json:"expires_at"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&responseData); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return responseData.SessionToken, nil
+	if responseData.ExpiresAt == 0 {
+		return responseData.SessionToken, time.Time{}, nil
+	}
+	return responseData.SessionToken, time.Unix(responseData.ExpiresAt, 0), nil
 }
@@ -1,34 +1,325 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"math/big"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
+	"github.com/p2m-lite/core/daemon/internal/key"
+	"github.com/p2m-lite/core/daemon/internal/sensor"
 )
 
+const (
+	DefaultGasLimitMargin = 20
+	DefaultSensorInterval = 10 * time.Second
+
+	DefaultQueueMaxReadings = 10000
+	DefaultQueueMaxAge      = 7 * 24 * time.Hour
+
+	DefaultBatchFlushInterval = 5 * time.Minute
+	DefaultHeartbeatInterval  = time.Minute
+	DefaultShutdownTimeout    = 30 * time.Second
+
+	// Submit modes: pay for log transactions, or sign them and let the API relay them
+	SubmitDirect = "direct"
+	SubmitRelay  = "relay"
+
+	// MaxBatchSize mirrors MAX_BATCH_SIZE in Log.sol
+	MaxBatchSize = 100
+)
+
+// Profiles let one host run several recorders, each with its own keys, queue and settings
+const (
+	ProfilesDirName = "profiles"
+	ProfileEnvFile  = ".env"
+)
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Error lists every problem found in a configuration
+type Error struct {
+	Profile  string
+	Problems []error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration")
+	if e.Profile != "" {
+		fmt.Fprintf(&b, " of profile %s", e.Profile)
+	}
+	b.WriteString(":")
+	for _, p := range e.Problems {
+		b.WriteString("\n  - " + p.Error())
+	}
+	return b.String()
+}
+
+func (e *Error) Unwrap() []error {
+	return e.Problems
+}
+
 type Config struct {
+	// Profile is the name of the loaded profile, empty for the default one
+	Profile string
+	// DataDir holds the keys and queue unless KEY_DIR or QUEUE_DIR point elsewhere
+	DataDir string
+	// Files are the config files that were read, most specific first
+	Files []string
+
+	APIURL          string
 	AuthURL         string
 	VerifyURL       string
 	ContractAddress string
+
+	// BlockchainURL is the RPC endpoint of direct submission. A nil ChainID
+	// accepts whatever chain the endpoint or relay reports.
+	BlockchainURL string
+	ChainID       *big.Int
+
+	// SubmitMode is SubmitDirect or SubmitRelay, the relay endpoints are used by the latter
+	SubmitMode       string
+	RelayNonceURL    string
+	RelayLogsURL     string
+	RelayRequestsURL string
+
+	// HeartbeatInterval is how often the daemon reports its status to HeartbeatURL, 0 disables it
+	HeartbeatURL      string
+	HeartbeatInterval time.Duration
+
+	// StatusAddr is where the local status server listens, empty disables it
+	StatusAddr string
+
+	// ShutdownTimeout is how long a transaction in flight may take to finish after SIGTERM
+	ShutdownTimeout time.Duration
+
+	// RotateURL receives the signed handover when the device key is rotated
+	RotateURL string
+
+	// Key selects plaintext or encrypted storage of the device key
+	Key key.Options
+
+	// Fee settings for log transactions. A nil cap means "no cap".
+	MaxFeePerGas   *big.Int
+	MaxTipPerGas   *big.Int
+	GasLimitMargin int // percent added on top of the gas estimate
+
+	// Sensor selects the probe driver, SensorInterval how often it is sampled
+	Sensor         sensor.Options
+	SensorInterval time.Duration
+
+	// Readings wait in a durable queue under QueueDir until they are on chain
+	QueueDir         string
+	QueueMaxReadings int
+	QueueMaxAge      time.Duration
+
+	// BatchSize > 1 submits readings in storeLogs batches, flushed at least every BatchFlushInterval
+	BatchSize          int
+	BatchFlushInterval time.Duration
 }
 
-func Load() (*Config, error) {
+// Load reads the configuration of a profile, "" being the default profile.
+// Settings come from, in order of precedence: the .env file of a named profile,
+// the environment (and ./.env), the profile's daemon.yaml and the config file.
+// The config file is file, $P2M_CONFIG or <UserConfigDir>/p2m-lite/daemon.yaml.
+// A named profile keeps its keys and queue under DATA_DIR/profiles/<name>.
+func Load(profile, file string) (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	apiURL := os.Getenv("API_URL")
-	if apiURL == "" {
-		apiURL = "http://localhost:8080" // Default
+	s := &settings{layers: []layer{{}}}
+	var files []string
+
+	if file == "" {
+		file = os.Getenv("P2M_CONFIG")
+	}
+	explicit := file != ""
+	if !explicit {
+		if configDir, err := os.UserConfigDir(); err == nil {
+			file = filepath.Join(configDir, key.AppDataDirName, FileName)
+		}
+	}
+	if file != "" {
+		base, err := readFile(file)
+		switch {
+		case err == nil:
+			s.layers = append(s.layers, base)
+			files = append(files, file)
+		case !explicit && errors.Is(err, fs.ErrNotExist):
+			// No config file, the environment has everything
+		default:
+			return nil, err
+		}
 	}
 
-	// Simple check to remove trailing slash if present to avoid double slashes
-	if len(apiURL) > 0 && apiURL[len(apiURL)-1] == '/' {
-		apiURL = apiURL[:len(apiURL)-1]
+	dataDir := s.get("DATA_DIR")
+	if dataDir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user config directory: %w", err)
+		}
+		dataDir = filepath.Join(configDir, key.AppDataDirName)
 	}
 
-	return &Config{
-		ContractAddress: os.Getenv("CONTRACT_ADDRESS"),
-		AuthURL:   apiURL + "/auth/initiate",
-		VerifyURL: apiURL + "/auth/verify",
-	}, nil
+	if profile != "" {
+		if !profileName.MatchString(profile) {
+			return nil, fmt.Errorf("invalid profile %q: use letters, digits, '-' and '_'", profile)
+		}
+		dataDir = filepath.Join(dataDir, ProfilesDirName, profile)
+
+		profileFile := filepath.Join(dataDir, FileName)
+		l, err := readFile(profileFile)
+		if err == nil {
+			s.layers = append([]layer{s.layers[0], l}, s.layers[1:]...)
+			files = append([]string{profileFile}, files...)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		envFile := filepath.Join(dataDir, ProfileEnvFile)
+		overrides, err := godotenv.Read(envFile)
+		if err == nil {
+			s.layers = append([]layer{{file: envFile, values: overrides}}, s.layers...)
+			files = append([]string{envFile}, files...)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read %s of profile %s: %w", ProfileEnvFile, profile, err)
+		}
+	}
+
+	cfg := &Config{Profile: profile, DataDir: dataDir, Files: files}
+
+	cfg.SubmitMode = s.oneOf("SUBMIT_MODE", SubmitDirect, SubmitDirect, SubmitRelay)
+
+	cfg.APIURL = strings.TrimSuffix(s.get("API_URL"), "/")
+	if cfg.APIURL == "" {
+		cfg.APIURL = "http://localhost:8080" // Default
+	} else if u, err := url.Parse(cfg.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		s.invalid("API_URL", "must be an http:// or https:// URL")
+	}
+	cfg.AuthURL = cfg.APIURL + "/auth/initiate"
+	cfg.VerifyURL = cfg.APIURL + "/auth/verify"
+	cfg.RelayNonceURL = cfg.APIURL + "/api/relay/nonce"
+	cfg.RelayLogsURL = cfg.APIURL + "/api/relay/logs"
+	cfg.RelayRequestsURL = cfg.APIURL + "/api/relay/requests"
+	cfg.HeartbeatURL = cfg.APIURL + "/api/devices/heartbeat"
+	cfg.RotateURL = cfg.APIURL + "/api/devices/rotate"
+
+	cfg.ContractAddress = s.get("CONTRACT_ADDRESS")
+	if cfg.ContractAddress == "" {
+		s.missing("CONTRACT_ADDRESS", "set it to the address of the deployed P2M contract")
+	} else if !common.IsHexAddress(cfg.ContractAddress) {
+		s.invalid("CONTRACT_ADDRESS", "must be a 0x-prefixed address of 40 hex digits")
+	}
+
+	cfg.BlockchainURL = s.get("BLOCKCHAIN_URL")
+	if cfg.BlockchainURL == "" {
+		if cfg.SubmitMode == SubmitDirect {
+			s.missing("BLOCKCHAIN_URL", "direct submission sends transactions through this RPC endpoint")
+		}
+	} else if u, err := url.Parse(cfg.BlockchainURL); err != nil || !rpcSchemes[u.Scheme] {
+		s.invalid("BLOCKCHAIN_URL", "must be an http(s):// or ws(s):// URL, or the path of an IPC socket")
+	}
+	if chainID := s.get("CHAIN_ID"); chainID != "" {
+		id, ok := new(big.Int).SetString(chainID, 10)
+		if !ok || id.Sign() <= 0 {
+			s.invalid("CHAIN_ID", "must be a positive integer such as 56 or 97")
+		} else {
+			cfg.ChainID = id
+		}
+	}
+
+	cfg.MaxFeePerGas = s.gwei("MAX_FEE_GWEI")
+	cfg.MaxTipPerGas = s.gwei("MAX_TIP_GWEI")
+	cfg.GasLimitMargin = s.integer("GAS_LIMIT_MARGIN", DefaultGasLimitMargin, 0, 1000)
+
+	cfg.Key = key.Options{
+		Dir:            s.get("KEY_DIR"),
+		Storage:        s.oneOf("KEY_STORAGE", key.StoragePEM, key.StoragePEM, key.StorageKeystore),
+		Passphrase:     s.get("KEY_PASSPHRASE"),
+		PassphraseFile: s.get("KEY_PASSPHRASE_FILE"),
+		LightKDF:       s.boolean("KEYSTORE_LIGHT_KDF", false),
+	}
+	if cfg.Key.Dir == "" {
+		cfg.Key.Dir = filepath.Join(dataDir, key.KeysDirName)
+	}
+
+	cfg.Sensor = loadSensorOptions(s)
+	cfg.SensorInterval = s.duration("SENSOR_INTERVAL", DefaultSensorInterval, false, "30s")
+
+	cfg.QueueDir = s.get("QUEUE_DIR")
+	if cfg.QueueDir == "" {
+		cfg.QueueDir = filepath.Join(dataDir, "queue")
+	}
+	cfg.QueueMaxReadings = s.integer("QUEUE_MAX_READINGS", DefaultQueueMaxReadings, 0, math.MaxInt32)
+	cfg.QueueMaxAge = s.duration("QUEUE_MAX_AGE", DefaultQueueMaxAge, true, "168h")
+
+	cfg.BatchSize = s.integer("BATCH_SIZE", 1, 1, MaxBatchSize)
+	cfg.BatchFlushInterval = s.duration("BATCH_FLUSH_INTERVAL", DefaultBatchFlushInterval, true, "5m")
+
+	cfg.StatusAddr = s.get("STATUS_ADDR")
+	if cfg.StatusAddr != "" {
+		if _, port, err := net.SplitHostPort(cfg.StatusAddr); err != nil || port == "" {
+			s.invalid("STATUS_ADDR", "must be host:port such as 127.0.0.1:9100")
+		}
+	}
+
+	cfg.HeartbeatInterval = s.duration("HEARTBEAT_INTERVAL", DefaultHeartbeatInterval, true, "1m (0 disables heartbeats)")
+	cfg.ShutdownTimeout = s.duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout, false, "30s")
+
+	if len(s.problems) > 0 {
+		return nil, &Error{Profile: profile, Problems: s.problems}
+	}
+	return cfg, nil
+}
+
+// rpcSchemes are the endpoints ethclient can dial, "" being an IPC socket path
+var rpcSchemes = map[string]bool{"http": true, "https": true, "ws": true, "wss": true, "": true}
+
+func loadSensorOptions(s *settings) sensor.Options {
+	opts := sensor.Options{
+		Driver: s.oneOf("SENSOR_DRIVER", sensor.DriverSimulator,
+			sensor.DriverSimulator, sensor.DriverSerial, sensor.DriverModbusRTU, sensor.DriverModbusTCP, sensor.DriverFile),
+		Port:               s.get("SENSOR_PORT"),
+		Baud:               s.integer("SENSOR_BAUD", 0, 0, math.MaxInt32),
+		Protocol:           s.oneOf("SENSOR_PROTOCOL", "", sensor.ProtocolCSV, sensor.ProtocolKV, sensor.ProtocolJSON),
+		Path:               s.get("SENSOR_PATH"),
+		ModbusAddress:      s.get("MODBUS_ADDRESS"),
+		ModbusRegisterType: s.oneOf("MODBUS_REGISTER_TYPE", "", "holding", "input"),
+		ModbusDataType:     s.oneOf("MODBUS_DATA_TYPE", "", "uint16", "int16", "float32"),
+		ModbusUnitID:       byte(s.integer("MODBUS_UNIT_ID", 1, 1, 247)),
+		PHRegister:         uint16(s.integer("MODBUS_PH_REGISTER", 0, 0, 0xFFFF)),
+		TurbidityRegister:  uint16(s.integer("MODBUS_TURBIDITY_REGISTER", 1, 0, 0xFFFF)),
+		PHScale:            s.number("MODBUS_PH_SCALE", 1),
+		TurbidityScale:     s.number("MODBUS_TURBIDITY_SCALE", 1),
+		PHUnit:             s.get("SENSOR_PH_UNIT"),
+		TurbidityUnit:      s.get("SENSOR_TURBIDITY_UNIT"),
+	}
+
+	// The drivers would only notice these when the daemon first samples
+	switch opts.Driver {
+	case sensor.DriverSerial, sensor.DriverModbusRTU:
+		if opts.Port == "" {
+			s.missing("SENSOR_PORT", "the "+opts.Driver+" driver reads from this serial port")
+		}
+	case sensor.DriverFile:
+		if opts.Path == "" {
+			s.missing("SENSOR_PATH", "the file driver reads from this file or named pipe")
+		}
+	case sensor.DriverModbusTCP:
+		if opts.ModbusAddress == "" {
+			s.missing("MODBUS_ADDRESS", "the modbus-tcp driver connects to this host:port")
+		}
+	}
+	return opts
 }
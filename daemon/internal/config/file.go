@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the config file looked up in the data directory and in profile directories
+const FileName = "daemon.yaml"
+
+// fileKeys maps environment variables to their key in the config file. Nested
+// keys are written as YAML mappings, "sensor.modbus.unit_id" is
+//
+//	sensor:
+//	  modbus:
+//	    unit_id: 1
+var fileKeys = map[string]string{
+	"API_URL":            "api_url",
+	"BLOCKCHAIN_URL":     "rpc_url",
+	"CONTRACT_ADDRESS":   "contract",
+	"CHAIN_ID":           "chain_id",
+	"SUBMIT_MODE":        "submit_mode",
+	"DATA_DIR":           "data_dir",
+	"HEARTBEAT_INTERVAL": "heartbeat_interval",
+	"STATUS_ADDR":        "status_addr",
+	"SHUTDOWN_TIMEOUT":   "shutdown_timeout",
+
+	"KEY_DIR":             "key.dir",
+	"KEY_STORAGE":         "key.storage",
+	"KEY_PASSPHRASE_FILE": "key.passphrase_file",
+	"KEYSTORE_LIGHT_KDF":  "key.light_kdf",
+
+	"MAX_FEE_GWEI":     "fees.max_fee_gwei",
+	"MAX_TIP_GWEI":     "fees.max_tip_gwei",
+	"GAS_LIMIT_MARGIN": "fees.gas_limit_margin",
+
+	"SENSOR_DRIVER":         "sensor.driver",
+	"SENSOR_INTERVAL":       "sensor.interval",
+	"SENSOR_PORT":           "sensor.port",
+	"SENSOR_BAUD":           "sensor.baud",
+	"SENSOR_PROTOCOL":       "sensor.protocol",
+	"SENSOR_PATH":           "sensor.path",
+	"SENSOR_PH_UNIT":        "sensor.ph_unit",
+	"SENSOR_TURBIDITY_UNIT": "sensor.turbidity_unit",
+
+	"MODBUS_ADDRESS":            "sensor.modbus.address",
+	"MODBUS_UNIT_ID":            "sensor.modbus.unit_id",
+	"MODBUS_REGISTER_TYPE":      "sensor.modbus.register_type",
+	"MODBUS_DATA_TYPE":          "sensor.modbus.data_type",
+	"MODBUS_PH_REGISTER":        "sensor.modbus.ph_register",
+	"MODBUS_TURBIDITY_REGISTER": "sensor.modbus.turbidity_register",
+	"MODBUS_PH_SCALE":           "sensor.modbus.ph_scale",
+	"MODBUS_TURBIDITY_SCALE":    "sensor.modbus.turbidity_scale",
+
+	"QUEUE_DIR":          "queue.dir",
+	"QUEUE_MAX_READINGS": "queue.max_readings",
+	"QUEUE_MAX_AGE":      "queue.max_age",
+
+	"BATCH_SIZE":           "batch.size",
+	"BATCH_FLUSH_INTERVAL": "batch.flush_interval",
+}
+
+// readFile parses a YAML config file into a layer keyed by environment names
+func readFile(path string) (layer, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return layer{}, fmt.Errorf("unsupported config file %s: use a .yaml file", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return layer{}, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return layer{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	flat := make(map[string]string)
+	if len(doc.Content) > 0 {
+		if err := flatten(doc.Content[0], "", flat); err != nil {
+			return layer{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	byKey := make(map[string]string, len(fileKeys))
+	for name, key := range fileKeys {
+		byKey[key] = name
+	}
+	l := layer{file: path, values: make(map[string]string), keys: fileKeys}
+	var unknown []string
+	for key, value := range flat {
+		name, ok := byKey[key]
+		if !ok {
+			unknown = append(unknown, key)
+			continue
+		}
+		l.values[name] = value
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return layer{}, fmt.Errorf("%s: unknown settings %s", path, strings.Join(unknown, ", "))
+	}
+	return l, nil
+}
+
+// flatten collects the scalars of a mapping under dotted keys. Scalars keep
+// their text, so "0x00ff" stays an address instead of becoming a number.
+func flatten(node *yaml.Node, prefix string, out map[string]string) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected a mapping of settings", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value.Kind {
+		case yaml.MappingNode:
+			if err := flatten(value, key, out); err != nil {
+				return err
+			}
+		case yaml.ScalarNode:
+			if value.Tag != "!!null" {
+				out[key] = value.Value
+			}
+		default:
+			return fmt.Errorf("line %d: %s must be a single value", value.Line, key)
+		}
+	}
+	return nil
+}
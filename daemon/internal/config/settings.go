@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// settings resolves settings by their environment variable name from layers,
+// the first layer that has a value wins. Problems are collected instead of
+// returned so one run reports everything that is wrong.
+type settings struct {
+	layers   []layer
+	problems []error
+}
+
+type layer struct {
+	// file is empty for the process environment
+	file   string
+	values map[string]string
+	// keys maps environment names to the names used in the file, for messages
+	keys map[string]string
+}
+
+// lookup returns the value of name, the key it was set under and the file it came from
+func (s *settings) lookup(name string) (value, key, file string) {
+	for _, l := range s.layers {
+		if l.values == nil {
+			if v, ok := os.LookupEnv(name); ok && v != "" {
+				return v, name, ""
+			}
+			continue
+		}
+		if v, ok := l.values[name]; ok && v != "" {
+			key := name
+			if k, ok := l.keys[name]; ok {
+				key = k
+			}
+			return v, key, l.file
+		}
+	}
+	return "", name, ""
+}
+
+func (s *settings) get(name string) string {
+	value, _, _ := s.lookup(name)
+	return value
+}
+
+// invalid records that the value of name is unusable, hint says what is expected
+func (s *settings) invalid(name, hint string) {
+	value, key, file := s.lookup(name)
+	if file != "" {
+		file = " in " + file
+	}
+	s.problems = append(s.problems, fmt.Errorf("invalid %s %q%s: %s", key, value, file, hint))
+}
+
+// missing records that a required setting is not set anywhere
+func (s *settings) missing(name, hint string) {
+	where := name
+	if key, ok := fileKeys[name]; ok {
+		where = fmt.Sprintf("%s (%s in the config file)", name, key)
+	}
+	s.problems = append(s.problems, fmt.Errorf("%s is not set: %s", where, hint))
+}
+
+func (s *settings) oneOf(name, fallback string, allowed ...string) string {
+	value := s.get(name)
+	if value == "" {
+		return fallback
+	}
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	s.invalid(name, "must be one of "+strings.Join(allowed, ", "))
+	return fallback
+}
+
+func (s *settings) integer(name string, fallback, min, max int) int {
+	value := s.get(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		s.invalid(name, fmt.Sprintf("must be an integer between %d and %d", min, max))
+		return fallback
+	}
+	return n
+}
+
+func (s *settings) number(name string, fallback float64) float64 {
+	value := s.get(name)
+	if value == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		s.invalid(name, "must be a number")
+		return fallback
+	}
+	return f
+}
+
+func (s *settings) boolean(name string, fallback bool) bool {
+	value := s.get(name)
+	if value == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		s.invalid(name, "must be true or false")
+		return fallback
+	}
+	return b
+}
+
+// duration reads a duration such as example, zero is only accepted with allowZero
+func (s *settings) duration(name string, fallback time.Duration, allowZero bool, example string) time.Duration {
+	value := s.get(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 || (d == 0 && !allowZero) {
+		if allowZero {
+			s.invalid(name, "must be a duration such as "+example)
+		} else {
+			s.invalid(name, "must be a positive duration such as "+example)
+		}
+		return fallback
+	}
+	return d
+}
+
+// gwei reads a (possibly fractional) gwei amount and returns it in wei
+func (s *settings) gwei(name string) *big.Int {
+	value := s.get(name)
+	if value == "" {
+		return nil
+	}
+	gwei, ok := new(big.Rat).SetString(value)
+	if !ok || gwei.Sign() < 0 {
+		s.invalid(name, "must be a non-negative gwei amount")
+		return nil
+	}
+	wei := new(big.Rat).Mul(gwei, new(big.Rat).SetInt64(1_000_000_000))
+	return new(big.Int).Quo(wei.Num(), wei.Denom())
+}
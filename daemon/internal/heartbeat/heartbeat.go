@@ -0,0 +1,110 @@
+package heartbeat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/p2m-lite/core/daemon/internal/auth"
+)
+
+var errUnauthorized = errors.New("heartbeat rejected the session token")
+
+type Reading struct {
+	PH        float64 `json:"ph"`
+	Turbidity float64 `json:"turbidity"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// Status is what the daemon reports about itself with every heartbeat
+type Status struct {
+	Firmware      string   `json:"firmware"`
+	QueueDepth    int      `json:"queue_depth"`
+	UptimeSeconds int64    `json:"uptime_seconds"`
+	LastReading   *Reading `json:"last_reading,omitempty"`
+}
+
+// Reporter pushes the daemon's status to the API so it can tell when a recorder goes offline
+type Reporter struct {
+	client *http.Client
+	url    string
+	auth   *auth.Service
+	status func() Status
+}
+
+func NewReporter(url string, auth *auth.Service, status func() Status) *Reporter {
+	return &Reporter{
+		client: &http.Client{Timeout: 10 * time.Second},
+		url:    url,
+		auth:   auth,
+		status: status,
+	}
+}
+
+// Run sends a heartbeat right away and then every interval until ctx is cancelled
+func (r *Reporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := r.Send(); err != nil {
+			log.Printf("Failed to send heartbeat: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send reports the current status once, signing in again if the session was rejected
+func (r *Reporter) Send() error {
+	b, err := json.Marshal(r.status())
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON payload: %w", err)
+	}
+
+	token, err := r.auth.Token()
+	if err != nil {
+		return err
+	}
+	err = r.post(token, b)
+	if errors.Is(err, errUnauthorized) {
+		r.auth.Invalidate(token)
+		if token, err = r.auth.Token(); err != nil {
+			return err
+		}
+		err = r.post(token, b)
+	}
+	return err
+}
+
+func (r *Reporter) post(token string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned error status: %s, body: %s", resp.Status, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultDerivationPath is the first account of the usual Ethereum wallets (BIP-44)
+const DefaultDerivationPath = "m/44'/60'/0'/0/0"
+
+// FromMnemonic derives the key at path from a BIP-39 mnemonic and optional passphrase.
+// The seed follows BIP-39 and the derivation BIP-32. The mnemonic checksum is not
+// verified because that needs the wordlist, so compare the resulting address with the
+// wallet the mnemonic came from.
+func FromMnemonic(mnemonic, passphrase, path string) (*ecdsa.PrivateKey, error) {
+	words := strings.Fields(strings.ToLower(mnemonic))
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return nil, fmt.Errorf("a mnemonic has 12, 15, 18, 21 or 24 words, got %d", len(words))
+	}
+	for _, word := range words {
+		for _, r := range word {
+			if r < 'a' || r > 'z' {
+				// Non-English wordlists need Unicode normalization, which we do not do
+				return nil, fmt.Errorf("mnemonic word %q is not from the English wordlist", word)
+			}
+		}
+	}
+
+	derivationPath, err := accounts.ParseDerivationPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid derivation path %q: %w", path, err)
+	}
+
+	seed, err := pbkdf2.Key(sha512.New, strings.Join(words, " "), []byte("mnemonic"+passphrase), 2048, 64)
+	if err != nil {
+		return nil, err
+	}
+	return deriveKey(seed, derivationPath)
+}
+
+// deriveKey walks the BIP-32 private derivation from the master key of seed
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	master := hmacSHA512([]byte("Bitcoin seed"), seed)
+	key, chainCode := new(big.Int).SetBytes(master[:32]), master[32:]
+	if !validScalar(key) {
+		return nil, errors.New("seed yields an invalid master key")
+	}
+
+	for _, index := range path {
+		data := make([]byte, 0, 37)
+		if index >= 0x80000000 {
+			// Hardened child: 0x00 || ser256(k) || ser32(i)
+			data = append(data, 0)
+			data = append(data, padScalar(key)...)
+		} else {
+			// Normal child: serP(point(k)) || ser32(i)
+			private, err := crypto.ToECDSA(padScalar(key))
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, crypto.CompressPubkey(&private.PublicKey)...)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		sum := hmacSHA512(chainCode, data)
+		tweak := new(big.Int).SetBytes(sum[:32])
+		if tweak.Cmp(crypto.S256().Params().N) >= 0 {
+			return nil, fmt.Errorf("derivation index %d yields an invalid key, use another path", index)
+		}
+		key = new(big.Int).Mod(new(big.Int).Add(tweak, key), crypto.S256().Params().N)
+		if !validScalar(key) {
+			return nil, fmt.Errorf("derivation index %d yields an invalid key, use another path", index)
+		}
+		chainCode = sum[32:]
+	}
+	return crypto.ToECDSA(padScalar(key))
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func validScalar(k *big.Int) bool {
+	return k.Sign() > 0 && k.Cmp(crypto.S256().Params().N) < 0
+}
+
+func padScalar(k *big.Int) []byte {
+	return k.FillBytes(make([]byte, 32))
+}
@@ -0,0 +1,86 @@
+package key
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Formats a key can be imported from or exported to
+const (
+	FormatAuto     = "auto"
+	FormatHex      = "hex"
+	FormatPEM      = "pem"
+	FormatKeystore = "keystore"
+	FormatMnemonic = "mnemonic"
+)
+
+// ImportOptions carries what some formats need besides the key material
+type ImportOptions struct {
+	// Passphrase decrypts an imported keystore file, or is the BIP-39 passphrase of a mnemonic
+	Passphrase string
+	// Path is the BIP-32 derivation path of a mnemonic
+	Path string
+}
+
+// DetectFormat guesses the format of key material
+func DetectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatKeystore
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		return FormatPEM
+	case len(strings.Fields(string(trimmed))) > 1:
+		return FormatMnemonic
+	default:
+		return FormatHex
+	}
+}
+
+// Parse reads a private key in the given format, FormatAuto detects it
+func Parse(format string, data []byte, opts ImportOptions) (*ecdsa.PrivateKey, error) {
+	if format == FormatAuto {
+		format = DetectFormat(data)
+	}
+	switch format {
+	case FormatHex:
+		return ParseHex(string(data))
+	case FormatPEM:
+		return ParsePEM(data)
+	case FormatKeystore:
+		key, err := keystore.DecryptKey(data, opts.Passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt keystore: %w", err)
+		}
+		return key.PrivateKey, nil
+	case FormatMnemonic:
+		path := opts.Path
+		if path == "" {
+			path = DefaultDerivationPath
+		}
+		return FromMnemonic(string(data), opts.Passphrase, path)
+	default:
+		return nil, fmt.Errorf("unknown key format %q", format)
+	}
+}
+
+// ParseHex reads a raw 32 byte private key, with or without 0x prefix
+func ParseHex(s string) (*ecdsa.PrivateKey, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "0x")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("private key is not valid hex")
+	}
+	key, err := crypto.ToECDSA(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return key, nil
+}
@@ -1,6 +1,7 @@
 package key
 
 import (
+	"crypto/ecdsa"
 	"encoding/pem"
 
 	"github.com/ethereum/go-ethereum/crypto"
@@ -25,3 +26,13 @@ func GenerateECCKeyPairWeb3() ([]byte, []byte, error) {
 
 	return privPem, pubPem, nil
 }
+
+// encodePublicKeyPEM serializes a public key the same way GenerateECCKeyPairWeb3 does
+func encodePublicKeyPEM(pub *ecdsa.PublicKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "SECP256K1 PUBLIC KEY", Bytes: crypto.FromECDSAPub(pub)})
+}
+
+// encodePrivateKeyPEM serializes a private key the same way GenerateECCKeyPairWeb3 does
+func encodePrivateKeyPEM(key *ecdsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "SECP256K1 PRIVATE KEY", Bytes: crypto.FromECDSA(key)})
+}
@@ -0,0 +1,195 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// ensureKeystore makes sure an encrypted key exists, converting a plaintext
+// private.pem left by an earlier version if there is one
+func (m *Manager) ensureKeystore() error {
+	keystorePath := filepath.Join(m.keysDir, KeystoreFile)
+	privPath := filepath.Join(m.keysDir, PrivateKeyFile)
+
+	var key *ecdsa.PrivateKey
+	var err error
+	switch {
+	case m.fileExists(keystorePath):
+		// Unlock right away so a wrong passphrase fails at startup
+		if key, err = m.unlockKeystore(); err != nil {
+			return err
+		}
+		if m.fileExists(privPath) {
+			if err := m.removePlaintextKey(key); err != nil {
+				return err
+			}
+		}
+
+	case m.fileExists(privPath):
+		log.Printf("Migrating %s to an encrypted %s...", PrivateKeyFile, KeystoreFile)
+		if key, err = readPEMKey(privPath); err != nil {
+			return err
+		}
+		if err := m.writeKeystore(key); err != nil {
+			return err
+		}
+		if err := m.removePlaintextKey(key); err != nil {
+			return err
+		}
+		log.Println("Private key migrated to the keystore.")
+
+	default:
+		if key, err = crypto.GenerateKey(); err != nil {
+			return fmt.Errorf("failed to generate keys: %w", err)
+		}
+		if err := m.writeKeystore(key); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	m.key = key
+	m.mu.Unlock()
+
+	pubPath := filepath.Join(m.keysDir, PublicKeyFile)
+	if !m.fileExists(pubPath) {
+		if err := os.WriteFile(pubPath, encodePublicKeyPEM(&key.PublicKey), 0644); err != nil {
+			return fmt.Errorf("failed to write public key: %w", err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) unlockKeystore() (*ecdsa.PrivateKey, error) {
+	keyJSON, err := os.ReadFile(filepath.Join(m.keysDir, KeystoreFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %w", err)
+	}
+	passphrase, err := m.opts.passphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock keystore: %w", err)
+	}
+	return key.PrivateKey, nil
+}
+
+// writeKeystore encrypts key with a new passphrase and stores it atomically
+func (m *Manager) writeKeystore(key *ecdsa.PrivateKey) error {
+	passphrase, err := m.opts.passphrase(true)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return fmt.Errorf("failed to generate key id: %w", err)
+	}
+
+	scryptN, scryptP := m.scryptParams()
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{
+		Id:         id,
+		Address:    crypto.PubkeyToAddress(key.PublicKey),
+		PrivateKey: key,
+	}, passphrase, scryptN, scryptP)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	keystorePath := filepath.Join(m.keysDir, KeystoreFile)
+	if err := writeFileAtomic(keystorePath, keyJSON, 0600); err != nil {
+		return fmt.Errorf("failed to write keystore: %w", err)
+	}
+
+	// Callers delete the plaintext key next, so make sure what reached the disk unlocks
+	stored, err := os.ReadFile(keystorePath)
+	if err != nil {
+		return fmt.Errorf("failed to read back keystore: %w", err)
+	}
+	decrypted, err := keystore.DecryptKey(stored, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to unlock the keystore just written: %w", err)
+	}
+	if !decrypted.PrivateKey.Equal(key) {
+		return errors.New("keystore just written holds a different key")
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data so a crash leaves either the old or the new
+// contents, syncing the file and then its directory so the rename is durable too
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes directory entries to disk. Windows cannot sync directories and
+// makes renames durable on its own.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (m *Manager) scryptParams() (int, int) {
+	if m.opts.LightKDF {
+		return keystore.LightScryptN, keystore.LightScryptP
+	}
+	return keystore.StandardScryptN, keystore.StandardScryptP
+}
+
+// removePlaintextKey deletes private.pem once the keystore is known to hold the same key.
+// key must have been decrypted from the keystore on disk, not taken from memory.
+func (m *Manager) removePlaintextKey(key *ecdsa.PrivateKey) error {
+	privPath := filepath.Join(m.keysDir, PrivateKeyFile)
+	plain, err := readPEMKey(privPath)
+	if err != nil {
+		return err
+	}
+	if !plain.Equal(key) {
+		return errors.New("private.pem and the keystore hold different keys, remove the one that is not in use")
+	}
+	if err := os.Remove(privPath); err != nil {
+		return fmt.Errorf("failed to remove plaintext private key: %w", err)
+	}
+	log.Printf("Removed plaintext %s. Copies in backups or on flash storage may still exist.", PrivateKeyFile)
+	return nil
+}
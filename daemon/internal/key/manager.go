@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/ethereum/go-ethereum/crypto"
 )
@@ -16,24 +17,51 @@ const (
 	KeysDirName    = "keys"
 	PrivateKeyFile = "private.pem"
 	PublicKeyFile  = "public.pem"
+	KeystoreFile   = "keystore.json"
 	AppDataDirName = "p2m-lite"
 )
 
+// Key storage formats
+const (
+	StoragePEM      = "pem"      // plaintext private.pem
+	StorageKeystore = "keystore" // Web3 Secret Storage v3, encrypted with a passphrase
+)
+
+// Options selects how the private key is kept on disk
+type Options struct {
+	// Dir holds the key files, <UserConfigDir>/p2m-lite/keys when empty
+	Dir     string
+	Storage string
+	// Passphrase unlocks the keystore. When empty it is read from PassphraseFile,
+	// or prompted for on a terminal.
+	Passphrase     string
+	PassphraseFile string
+	// LightKDF uses cheaper scrypt parameters for devices with little memory
+	LightKDF bool
+}
+
 type Manager struct {
 	keysDir string
+	opts    Options
+
+	// The decrypted key is kept so the keystore is only unlocked once
+	mu  sync.Mutex
+	key *ecdsa.PrivateKey
 }
 
-func NewManager() (*Manager, error) {
-	configDir, err := os.UserConfigDir()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user config directory: %w", err)
+func NewManager(opts Options) (*Manager, error) {
+	keysDir := opts.Dir
+	if keysDir == "" {
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user config directory: %w", err)
+		}
+		keysDir = filepath.Join(configDir, AppDataDirName, KeysDirName)
 	}
 
-	appDataDir := filepath.Join(configDir, AppDataDirName)
-	keysDir := filepath.Join(appDataDir, KeysDirName)
-
 	return &Manager{
 		keysDir: keysDir,
+		opts:    opts,
 	}, nil
 }
 
@@ -41,6 +69,9 @@ func (m *Manager) EnsureKeys() error {
 	if err := os.MkdirAll(m.keysDir, 0700); err != nil {
 		return fmt.Errorf("failed to create keys directory: %w", err)
 	}
+	if m.opts.Storage == StorageKeystore {
+		return m.ensureKeystore()
+	}
 
 	privPath := filepath.Join(m.keysDir, PrivateKeyFile)
 	pubPath := filepath.Join(m.keysDir, PublicKeyFile)
@@ -48,6 +79,10 @@ func (m *Manager) EnsureKeys() error {
 	if m.fileExists(privPath) && m.fileExists(pubPath) {
 		return nil // Keys already exist
 	}
+	if !m.fileExists(privPath) && m.fileExists(filepath.Join(m.keysDir, KeystoreFile)) {
+		// Never replace the device identity just because the storage setting is wrong
+		return fmt.Errorf("the private key is encrypted in %s, set KEY_STORAGE=%s", KeystoreFile, StorageKeystore)
+	}
 
 	// Generate new keys
 	privPem, pubPem, err := GenerateECCKeyPairWeb3()
@@ -66,12 +101,37 @@ func (m *Manager) EnsureKeys() error {
 }
 
 func (m *Manager) GetPrivateKey() (*ecdsa.PrivateKey, error) {
-	privPath := filepath.Join(m.keysDir, PrivateKeyFile)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.key != nil {
+		return m.key, nil
+	}
+
+	var key *ecdsa.PrivateKey
+	var err error
+	if m.opts.Storage == StorageKeystore {
+		key, err = m.unlockKeystore()
+	} else {
+		key, err = readPEMKey(filepath.Join(m.keysDir, PrivateKeyFile))
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.key = key
+	return key, nil
+}
+
+// readPEMKey parses a plaintext private key file
+func readPEMKey(privPath string) (*ecdsa.PrivateKey, error) {
 	privBytes, err := os.ReadFile(privPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read private key file: %w", err)
 	}
+	return ParsePEM(privBytes)
+}
 
+// ParsePEM decodes a secp256k1 private key in PKCS#8, SEC 1 or raw PEM form
+func ParsePEM(privBytes []byte) (*ecdsa.PrivateKey, error) {
 	block, _ := pem.Decode(privBytes)
 	if block == nil {
 		return nil, errors.New("failed to decode PEM block from private key file")
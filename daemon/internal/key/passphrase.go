@@ -0,0 +1,71 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// passphrase returns the keystore passphrase from the options, its file or a terminal
+// prompt. A new passphrase is prompted for twice to catch typos.
+func (o Options) passphrase(confirm bool) (string, error) {
+	if o.Passphrase != "" {
+		return o.Passphrase, nil
+	}
+
+	if o.PassphraseFile != "" {
+		b, err := os.ReadFile(o.PassphraseFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase file: %w", err)
+		}
+		passphrase := strings.TrimRight(string(b), "\r\n")
+		if passphrase == "" {
+			return "", fmt.Errorf("passphrase file %s is empty", o.PassphraseFile)
+		}
+		return passphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("keystore needs a passphrase: set KEY_PASSPHRASE or KEY_PASSPHRASE_FILE")
+	}
+	passphrase, err := prompt(fd, "Keystore passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", errors.New("keystore passphrase must not be empty")
+	}
+	if confirm {
+		repeated, err := prompt(fd, "Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if repeated != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+func prompt(fd int, label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(b), nil
+}
+
+// ReadSecret prompts for a secret on the terminal without echoing it
+func ReadSecret(label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("no terminal to prompt on")
+	}
+	return prompt(fd, label)
+}
@@ -0,0 +1,170 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+)
+
+// ArchiveDirName holds keys that were replaced by an import or rotation
+const ArchiveDirName = "archive"
+
+// ErrKeyExists is returned by Store when the device already has a key and replacing it was not requested
+var ErrKeyExists = errors.New("a device key already exists")
+
+// Static serves a key held in memory, e.g. a new key before it is stored
+type Static struct {
+	Key *ecdsa.PrivateKey
+}
+
+func (s Static) GetPrivateKey() (*ecdsa.PrivateKey, error) {
+	return s.Key, nil
+}
+
+func (s Static) GetPublicKeyPEM() (string, error) {
+	return string(encodePublicKeyPEM(&s.Key.PublicKey)), nil
+}
+
+// Dir is the directory the key files live in
+func (m *Manager) Dir() string {
+	return m.keysDir
+}
+
+// Storage is the configured storage format
+func (m *Manager) Storage() string {
+	if m.opts.Storage == "" {
+		return StoragePEM
+	}
+	return m.opts.Storage
+}
+
+// HasKey reports whether a private key is stored in either format
+func (m *Manager) HasKey() bool {
+	return m.fileExists(filepath.Join(m.keysDir, PrivateKeyFile)) || m.fileExists(filepath.Join(m.keysDir, KeystoreFile))
+}
+
+// Address is the Ethereum address of the device key
+func (m *Manager) Address() (common.Address, error) {
+	key, err := m.GetPrivateKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
+
+// Store saves key as the device key in the configured storage. An existing key is only
+// replaced when replace is set; its files are moved to an archive directory first, which
+// is returned so the change can be undone with Restore.
+func (m *Manager) Store(key *ecdsa.PrivateKey, replace bool) (string, error) {
+	if err := os.MkdirAll(m.keysDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	archived := ""
+	if m.HasKey() {
+		if !replace {
+			return "", ErrKeyExists
+		}
+		var err error
+		if archived, err = m.archive(); err != nil {
+			return "", err
+		}
+	}
+
+	var err error
+	if m.Storage() == StorageKeystore {
+		err = m.writeKeystore(key)
+	} else {
+		err = writeFileAtomic(filepath.Join(m.keysDir, PrivateKeyFile), encodePrivateKeyPEM(key), 0600)
+	}
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(m.keysDir, PublicKeyFile), encodePublicKeyPEM(&key.PublicKey), 0644)
+	}
+	if err != nil {
+		if archived != "" {
+			if _, rErr := m.Restore(archived); rErr != nil {
+				return "", fmt.Errorf("failed to store key: %w (restoring the previous key failed too: %v, it is in %s)", err, rErr, archived)
+			}
+		}
+		return "", fmt.Errorf("failed to store key: %w", err)
+	}
+
+	m.mu.Lock()
+	m.key = key
+	m.mu.Unlock()
+	return archived, nil
+}
+
+// Restore brings back the key files moved away by Store. The key files in use are
+// not deleted but archived in turn, in the returned directory.
+func (m *Manager) Restore(archived string) (string, error) {
+	replaced, err := m.archive()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{PrivateKeyFile, KeystoreFile, PublicKeyFile} {
+		if err := os.Rename(filepath.Join(archived, name), filepath.Join(m.keysDir, name)); err != nil && !os.IsNotExist(err) {
+			return replaced, err
+		}
+	}
+	m.mu.Lock()
+	m.key = nil
+	m.mu.Unlock()
+	return replaced, os.Remove(archived)
+}
+
+// archive moves the current key files into a new directory under ArchiveDirName
+func (m *Manager) archive() (string, error) {
+	dir := filepath.Join(m.keysDir, ArchiveDirName, strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	for _, name := range []string{PrivateKeyFile, KeystoreFile, PublicKeyFile} {
+		if err := os.Rename(filepath.Join(m.keysDir, name), filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+	}
+	return dir, nil
+}
+
+// Export serializes the device key. Keystore exports are encrypted with a new passphrase.
+func (m *Manager) Export(format string) ([]byte, error) {
+	key, err := m.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatHex:
+		return []byte(hex.EncodeToString(crypto.FromECDSA(key)) + "\n"), nil
+	case FormatPEM:
+		return encodePrivateKeyPEM(key), nil
+	case FormatKeystore:
+		passphrase, err := m.opts.passphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return nil, err
+		}
+		scryptN, scryptP := m.scryptParams()
+		return keystore.EncryptKey(&keystore.Key{
+			Id:         id,
+			Address:    crypto.PubkeyToAddress(key.PublicKey),
+			PrivateKey: key,
+		}, passphrase, scryptN, scryptP)
+	default:
+		return nil, fmt.Errorf("cannot export to format %q", format)
+	}
+}
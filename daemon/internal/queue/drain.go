@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/p2m-lite/core/daemon/internal/sensor"
+)
+
+// Retry delays of a failed send, doubling up to the maximum
+const (
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 5 * time.Minute
+)
+
+// ErrRejected marks a send error that retrying cannot fix, such as a contract revert.
+// Send functions wrap it so Drain sets the readings aside instead of retrying them.
+var ErrRejected = errors.New("readings rejected")
+
+// Batching groups readings into one submission. A batch is sent once it holds Size
+// readings or its oldest reading has waited FlushInterval. A Size of 1 sends every
+// reading on its own.
+type Batching struct {
+	Size          int
+	FlushInterval time.Duration
+}
+
+// Drain sends queued readings oldest first until ctx is cancelled. Readings are only
+// removed after send succeeds; failures are retried with exponential backoff so later
+// readings never overtake an earlier one. Rejected readings are moved to the rejected
+// log so they cannot hold up the rest of the queue.
+func (q *Queue) Drain(ctx context.Context, batching Batching, send func([]sensor.Reading) error) {
+	size := max(batching.Size, 1)
+	delay := minRetryDelay
+	// pinned is the last reading of a batch that failed to send. Its retry sends the
+	// same readings, not more that arrived since, so a transaction that is still
+	// pending is recognized instead of the readings being sent twice.
+	var pinned uint64
+	for {
+		entries := q.Peek(size)
+		if pinned != 0 {
+			n := 0
+			for n < len(entries) && entries[n].Seq <= pinned {
+				n++
+			}
+			entries = entries[:n]
+			if n == 0 {
+				pinned = 0
+			}
+		}
+		if len(entries) == 0 {
+			if !q.wait(ctx, nil) {
+				return
+			}
+			continue
+		}
+
+		if pinned == 0 && len(entries) < size {
+			if wait := batching.FlushInterval - time.Since(entries[0].QueuedAt); wait > 0 {
+				if !q.wait(ctx, time.After(wait)) {
+					return
+				}
+				continue
+			}
+		}
+
+		readings := make([]sensor.Reading, len(entries))
+		for i, entry := range entries {
+			readings[i] = entry.Reading
+		}
+		first, last := entries[0].Seq, entries[len(entries)-1].Seq
+
+		err := send(readings)
+		if errors.Is(err, ErrRejected) {
+			log.Printf("Queue: Readings %d-%d were rejected, moving them to %s: %v", first, last, rejectedFile, err)
+			if err := q.Reject(last); err != nil {
+				log.Printf("Queue: Failed to set rejected readings %d-%d aside: %v", first, last, err)
+			}
+			delay, pinned = minRetryDelay, 0
+			continue
+		}
+		if err != nil {
+			pinned = last
+			log.Printf("Queue: Failed to send readings %d-%d (%d pending), retrying in %s: %v", first, last, q.Stats().Depth, delay, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+		delay, pinned = minRetryDelay, 0
+
+		if err := q.Ack(last); err != nil {
+			log.Printf("Queue: Readings %d-%d were sent but could not be removed: %v", first, last, err)
+		}
+	}
+}
+
+// wait blocks until new readings arrive, timeout fires or ctx is cancelled
+func (q *Queue) wait(ctx context.Context, timeout <-chan time.Time) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-q.Ready():
+	case <-timeout:
+	}
+	return true
+}
@@ -0,0 +1,408 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/p2m-lite/core/daemon/internal/sensor"
+)
+
+const (
+	logFile      = "readings.log"
+	ackFile      = "readings.ack"
+	rejectedFile = "rejected.log"
+
+	// compactThreshold is how many removed records the log may carry before it is rewritten
+	compactThreshold = 1000
+)
+
+// Limits cap the queue so a long outage cannot fill the disk. Zero values are not enforced.
+type Limits struct {
+	MaxReadings int
+	MaxAge      time.Duration
+}
+
+// Entry is a queued reading
+type Entry struct {
+	Seq      uint64
+	Reading  sensor.Reading
+	QueuedAt time.Time
+}
+
+// Stats describe the backlog of unsent readings
+type Stats struct {
+	Depth   int
+	Oldest  time.Time // zero when the queue is empty
+	Dropped uint64    // readings discarded by the limits since startup
+}
+
+// record is the on-disk form of an entry, one JSON object per line
+type record struct {
+	Seq           uint64  `json:"seq"`
+	Timestamp     int64   `json:"ts"` // unix milliseconds
+	PH            float64 `json:"ph"`
+	PHUnit        string  `json:"ph_unit"`
+	Turbidity     float64 `json:"turbidity"`
+	TurbidityUnit string  `json:"turbidity_unit"`
+	QueuedAt      int64   `json:"queued_at"`
+}
+
+// Queue is a durable FIFO of readings. Readings are appended to a log file and
+// removed by advancing an acknowledgement marker, so a crash never loses or
+// duplicates more than the reading being sent.
+type Queue struct {
+	dir    string
+	limits Limits
+
+	mu      sync.Mutex
+	log     *os.File
+	entries []Entry
+	nextSeq uint64
+	removed int // records in the log file before the first live entry
+	dropped uint64
+	wake    chan struct{}
+}
+
+// Open loads the queue stored in dir, creating it if needed
+func Open(dir string, limits Limits) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+
+	q := &Queue{dir: dir, limits: limits, wake: make(chan struct{}, 1)}
+	acked, err := q.readAck()
+	if err != nil {
+		return nil, err
+	}
+	if err := q.load(acked); err != nil {
+		return nil, err
+	}
+
+	q.log, err = os.OpenFile(filepath.Join(dir, logFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue log: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enforceLimits(time.Now())
+	if err := q.maybeCompact(); err != nil {
+		return nil, err
+	}
+	if len(q.entries) > 0 {
+		q.signal()
+	}
+	return q, nil
+}
+
+func (q *Queue) readAck() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, ackFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read queue marker: %w", err)
+	}
+	acked, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupt queue marker %q", data)
+	}
+	return acked, nil
+}
+
+func (q *Queue) load(acked uint64) error {
+	path := filepath.Join(q.dir, logFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		q.nextSeq = acked + 1
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read queue log: %w", err)
+	}
+
+	// A crash during an append leaves a partial last line behind
+	if i := bytes.LastIndexByte(data, '\n'); i != len(data)-1 {
+		log.Printf("Queue: Discarding partial record at the end of %s", path)
+		data = data[:i+1]
+		if err := os.Truncate(path, int64(len(data))); err != nil {
+			return fmt.Errorf("failed to repair queue log: %w", err)
+		}
+	}
+
+	q.nextSeq = acked + 1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			log.Printf("Queue: Skipping corrupt record: %v", err)
+			q.removed++
+			continue
+		}
+		if rec.Seq >= q.nextSeq {
+			q.nextSeq = rec.Seq + 1
+		}
+		if rec.Seq <= acked {
+			q.removed++
+			continue
+		}
+		q.entries = append(q.entries, rec.entry())
+	}
+	return scanner.Err()
+}
+
+// Push stores a reading durably. The oldest readings are dropped when the queue is full.
+func (q *Queue) Push(r sensor.Reading) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := Entry{Seq: q.nextSeq, Reading: r, QueuedAt: time.Now()}
+	line, err := json.Marshal(newRecord(entry))
+	if err != nil {
+		return err
+	}
+	if _, err := q.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to queue: %w", err)
+	}
+	if err := q.log.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue: %w", err)
+	}
+	q.nextSeq++
+	q.entries = append(q.entries, entry)
+
+	q.enforceLimits(entry.QueuedAt)
+	q.signal()
+	return q.maybeCompact()
+}
+
+// Peek returns up to n of the oldest readings without removing them
+func (q *Queue) Peek(n int) []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enforceLimits(time.Now())
+	n = min(n, len(q.entries))
+	return append([]Entry(nil), q.entries[:n]...)
+}
+
+// Ack removes every entry up to and including seq once they have been sent
+func (q *Queue) Ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for n < len(q.entries) && q.entries[n].Seq <= seq {
+		n++
+	}
+	if n == 0 {
+		// Already dropped by the limits while being sent
+		return nil
+	}
+	q.removeHead(n)
+	if err := q.writeAck(); err != nil {
+		return err
+	}
+	return q.maybeCompact()
+}
+
+// Reject moves every entry up to and including seq to the rejected log, in the same
+// format as the queue log, for readings the chain will never accept
+func (q *Queue) Reject(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var buf bytes.Buffer
+	n := 0
+	for ; n < len(q.entries) && q.entries[n].Seq <= seq; n++ {
+		line, err := json.Marshal(newRecord(q.entries[n]))
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if n == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Join(q.dir, rejectedFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open rejected log: %w", err)
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write rejected log: %w", err)
+	}
+
+	q.removeHead(n)
+	if err := q.writeAck(); err != nil {
+		return err
+	}
+	return q.maybeCompact()
+}
+
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := Stats{Depth: len(q.entries), Dropped: q.dropped}
+	if len(q.entries) > 0 {
+		stats.Oldest = q.entries[0].Reading.Timestamp
+	}
+	return stats
+}
+
+// Ready is signalled whenever readings are waiting
+func (q *Queue) Ready() <-chan struct{} {
+	return q.wake
+}
+
+// Close persists the acknowledgement marker and drops sent records from the log,
+// so the next start does not replay them, before closing the log
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var errs []error
+	if err := q.writeAck(); err != nil {
+		errs = append(errs, err)
+	} else if q.removed > 0 {
+		errs = append(errs, q.compact())
+	}
+	errs = append(errs, q.log.Close())
+	return errors.Join(errs...)
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enforceLimits drops readings beyond the size cap or older than the age cap, oldest first
+func (q *Queue) enforceLimits(now time.Time) {
+	drop := 0
+	if q.limits.MaxReadings > 0 && len(q.entries) > q.limits.MaxReadings {
+		drop = len(q.entries) - q.limits.MaxReadings
+	}
+	if q.limits.MaxAge > 0 {
+		cutoff := now.Add(-q.limits.MaxAge)
+		for drop < len(q.entries) && q.entries[drop].Reading.Timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return
+	}
+
+	log.Printf("Queue: Dropping %d unsent readings that exceed the queue limits", drop)
+	q.dropped += uint64(drop)
+	q.removeHead(drop)
+	if err := q.writeAck(); err != nil {
+		log.Printf("Queue: %v", err)
+	}
+}
+
+func (q *Queue) removeHead(n int) {
+	q.entries = q.entries[n:]
+	q.removed += n
+}
+
+// writeAck persists the sequence number up to which entries are gone
+func (q *Queue) writeAck() error {
+	acked := q.nextSeq - 1
+	if len(q.entries) > 0 {
+		acked = q.entries[0].Seq - 1
+	}
+	return writeFileAtomic(filepath.Join(q.dir, ackFile), []byte(strconv.FormatUint(acked, 10)+"\n"))
+}
+
+// maybeCompact rewrites the log without removed records once they dominate it
+func (q *Queue) maybeCompact() error {
+	if q.removed < compactThreshold || q.removed < len(q.entries) {
+		return nil
+	}
+	return q.compact()
+}
+
+// compact rewrites the log with the queued entries only
+func (q *Queue) compact() error {
+	var buf bytes.Buffer
+	for _, entry := range q.entries {
+		line, err := json.Marshal(newRecord(entry))
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	path := filepath.Join(q.dir, logFile)
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to compact queue: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to reopen queue log: %w", err)
+	}
+	q.log.Close()
+	q.log = f
+	q.removed = 0
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newRecord(e Entry) record {
+	return record{
+		Seq:           e.Seq,
+		Timestamp:     e.Reading.Timestamp.UnixMilli(),
+		PH:            e.Reading.PH.Value,
+		PHUnit:        e.Reading.PH.Unit,
+		Turbidity:     e.Reading.Turbidity.Value,
+		TurbidityUnit: e.Reading.Turbidity.Unit,
+		QueuedAt:      e.QueuedAt.UnixMilli(),
+	}
+}
+
+func (r record) entry() Entry {
+	return Entry{
+		Seq: r.Seq,
+		Reading: sensor.Reading{
+			Timestamp: time.UnixMilli(r.Timestamp),
+			PH:        sensor.Measurement{Value: r.PH, Unit: r.PHUnit},
+			Turbidity: sensor.Measurement{Value: r.Turbidity, Unit: r.TurbidityUnit},
+		},
+		QueuedAt: time.UnixMilli(r.QueuedAt),
+	}
+}
@@ -0,0 +1,227 @@
+package queue
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/p2m-lite/core/daemon/internal/sensor"
+)
+
+func reading(ph float64) sensor.Reading {
+	return sensor.Reading{
+		Timestamp: time.Now(),
+		PH:        sensor.Measurement{Value: ph, Unit: sensor.UnitPH},
+		Turbidity: sensor.Measurement{Value: 1, Unit: sensor.UnitNTU},
+	}
+}
+
+func TestReopen(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare fills the queue, which it then closes or abandons like a crash
+		prepare  func(t *testing.T, dir string)
+		wantSeqs []uint64
+		wantNext uint64 // sequence number of the next push
+	}{
+		{
+			name: "after a clean close",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 3)
+				mustClose(t, q)
+			},
+			wantSeqs: []uint64{1, 2, 3},
+			wantNext: 4,
+		},
+		{
+			name: "after a crash mid-append",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 3)
+				q.log.Close()
+				appendFile(t, filepath.Join(dir, logFile), `{"seq":4,"ts":17`)
+			},
+			wantSeqs: []uint64{1, 2, 3},
+			wantNext: 4,
+		},
+		{
+			name: "after a truncated last record",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 3)
+				q.log.Close()
+				path := filepath.Join(dir, logFile)
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Truncate(path, info.Size()-5); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantSeqs: []uint64{1, 2},
+			wantNext: 3,
+		},
+		{
+			name: "after acknowledging without closing",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 5)
+				if err := q.Ack(3); err != nil {
+					t.Fatal(err)
+				}
+				q.log.Close()
+			},
+			wantSeqs: []uint64{4, 5},
+			wantNext: 6,
+		},
+		{
+			name: "after compacting on close",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 5)
+				if err := q.Ack(3); err != nil {
+					t.Fatal(err)
+				}
+				mustClose(t, q)
+			},
+			wantSeqs: []uint64{4, 5},
+			wantNext: 6,
+		},
+		{
+			name: "after compacting everything away",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 3)
+				if err := q.Ack(3); err != nil {
+					t.Fatal(err)
+				}
+				mustClose(t, q)
+			},
+			wantSeqs: nil,
+			wantNext: 4,
+		},
+		{
+			name: "after compacting at the threshold",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, compactThreshold+2)
+				if err := q.Ack(compactThreshold + 1); err != nil {
+					t.Fatal(err)
+				}
+				if q.removed != 0 {
+					t.Fatalf("log was not compacted, %d removed records left", q.removed)
+				}
+				q.log.Close()
+			},
+			wantSeqs: []uint64{compactThreshold + 2},
+			wantNext: compactThreshold + 3,
+		},
+		{
+			name: "after rejecting readings",
+			prepare: func(t *testing.T, dir string) {
+				q := mustOpen(t, dir)
+				push(t, q, 3)
+				if err := q.Reject(2); err != nil {
+					t.Fatal(err)
+				}
+				mustClose(t, q)
+			},
+			wantSeqs: []uint64{3},
+			wantNext: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.prepare(t, dir)
+
+			q := mustOpen(t, dir)
+			defer q.Close()
+			entries := q.Peek(len(tt.wantSeqs) + 1)
+			if len(entries) != len(tt.wantSeqs) {
+				t.Fatalf("reopened queue holds %d readings, want %d", len(entries), len(tt.wantSeqs))
+			}
+			for i, entry := range entries {
+				if entry.Seq != tt.wantSeqs[i] {
+					t.Errorf("entry %d has seq %d, want %d", i, entry.Seq, tt.wantSeqs[i])
+				}
+				if entry.Reading.PH.Value != float64(entry.Seq) {
+					t.Errorf("entry %d has pH %v, want %d", i, entry.Reading.PH.Value, entry.Seq)
+				}
+			}
+
+			if err := q.Push(reading(float64(tt.wantNext))); err != nil {
+				t.Fatal(err)
+			}
+			entries = q.Peek(len(tt.wantSeqs) + 1)
+			if last := entries[len(entries)-1].Seq; last != tt.wantNext {
+				t.Errorf("next push got seq %d, want %d", last, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestRejectWritesRejectedLog(t *testing.T) {
+	dir := t.TempDir()
+	q := mustOpen(t, dir)
+	defer q.Close()
+	push(t, q, 3)
+	if err := q.Reject(2); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, rejectedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines int
+	for _, b := range data {
+		if b == '\n' {
+			lines++
+		}
+	}
+	if lines != 2 {
+		t.Errorf("rejected log holds %d records, want 2", lines)
+	}
+}
+
+func mustOpen(t *testing.T, dir string) *Queue {
+	t.Helper()
+	q, err := Open(dir, Limits{})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return q
+}
+
+func mustClose(t *testing.T, q *Queue) {
+	t.Helper()
+	if err := q.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+// push adds n readings whose pH is their expected sequence number
+func push(t *testing.T, q *Queue, n int) {
+	t.Helper()
+	for range n {
+		if err := q.Push(reading(float64(q.nextSeq))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
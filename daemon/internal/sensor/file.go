@@ -0,0 +1,62 @@
+package sensor
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// tailPollInterval is how often a regular file is checked for new lines
+const tailPollInterval = 500 * time.Millisecond
+
+// newFileSensor reads a line protocol from a named pipe or follows a regular file
+// that another program appends readings to, starting at its current end.
+func newFileSensor(opts Options) (Sensor, error) {
+	info, err := os.Stat(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+	isPipe := info.Mode()&os.ModeNamedPipe != 0
+
+	src := newLineSource(opts)
+	src.start(func() (io.ReadCloser, error) {
+		// Opening a pipe blocks until a writer connects; EOF means the writer left
+		f, err := os.Open(opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		if isPipe {
+			return f, nil
+		}
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &tailReader{f: f, done: src.done}, nil
+	})
+	return src, nil
+}
+
+// tailReader waits for more data at EOF instead of ending, like tail -f
+type tailReader struct {
+	f    *os.File
+	done <-chan struct{}
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		select {
+		case <-t.done:
+			return 0, io.EOF
+		case <-time.After(tailPollInterval):
+		}
+	}
+}
+
+func (t *tailReader) Close() error {
+	return t.f.Close()
+}
@@ -0,0 +1,298 @@
+package sensor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Line protocols understood by the serial and file drivers
+const (
+	// ProtocolCSV: "7.12,315.4" or "7.12,315.4,1718000000"
+	ProtocolCSV = "csv"
+	// ProtocolKV: "ph=7.12 turbidity=315.4NTU ts=2024-06-10T06:13:20Z"
+	ProtocolKV = "kv"
+	// ProtocolJSON: {"ph":7.12,"turbidity":315.4,"turbidity_unit":"NTU","timestamp":1718000000}
+	ProtocolJSON = "json"
+)
+
+// reopenDelay is how long a line source waits before reopening a failed device
+const reopenDelay = 2 * time.Second
+
+// parseLine decodes one line of the given protocol. Missing timestamps and units are filled from defaults.
+func parseLine(protocol, line string, opts Options) (Reading, error) {
+	reading := Reading{
+		PH:        Measurement{Unit: opts.PHUnit},
+		Turbidity: Measurement{Unit: opts.TurbidityUnit},
+	}
+
+	var err error
+	switch protocol {
+	case "", ProtocolCSV:
+		err = parseCSV(line, &reading)
+	case ProtocolKV:
+		err = parseKV(line, &reading)
+	case ProtocolJSON:
+		err = parseJSON(line, &reading)
+	default:
+		err = fmt.Errorf("unknown line protocol %q", protocol)
+	}
+	if err != nil {
+		return Reading{}, err
+	}
+
+	if reading.Timestamp.IsZero() {
+		reading.Timestamp = time.Now()
+	}
+	return reading, nil
+}
+
+func parseCSV(line string, r *Reading) error {
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 || len(fields) > 3 {
+		return fmt.Errorf("expected ph,turbidity[,timestamp], got %q", line)
+	}
+
+	var err error
+	if r.PH, err = parseMeasurement(fields[0], r.PH.Unit); err != nil {
+		return err
+	}
+	if r.Turbidity, err = parseMeasurement(fields[1], r.Turbidity.Unit); err != nil {
+		return err
+	}
+	if len(fields) == 3 {
+		r.Timestamp, err = parseTimestamp(strings.TrimSpace(fields[2]))
+	}
+	return err
+}
+
+func parseKV(line string, r *Reading) error {
+	seen := 0
+	for _, field := range strings.FieldsFunc(line, func(c rune) bool { return c == ' ' || c == ',' || c == ';' || c == '\t' }) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", field)
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "ph":
+			r.PH, err = parseMeasurement(value, r.PH.Unit)
+			seen++
+		case "turbidity", "turb", "ntu":
+			r.Turbidity, err = parseMeasurement(value, r.Turbidity.Unit)
+			seen++
+		case "ts", "time", "timestamp":
+			r.Timestamp, err = parseTimestamp(value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if seen != 2 {
+		return fmt.Errorf("line %q lacks ph or turbidity", line)
+	}
+	return nil
+}
+
+func parseJSON(line string, r *Reading) error {
+	var msg struct {
+		PH            *float64        `json:"ph"`
+		PHUnit        string          `json:"ph_unit"`
+		Turbidity     *float64        `json:"turbidity"`
+		TurbidityUnit string          `json:"turbidity_unit"`
+		Timestamp     json.RawMessage `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		return fmt.Errorf("invalid JSON reading: %w", err)
+	}
+	if msg.PH == nil || msg.Turbidity == nil {
+		return fmt.Errorf("reading %q lacks ph or turbidity", line)
+	}
+
+	r.PH.Value, r.Turbidity.Value = *msg.PH, *msg.Turbidity
+	if msg.PHUnit != "" {
+		r.PH.Unit = msg.PHUnit
+	}
+	if msg.TurbidityUnit != "" {
+		r.Turbidity.Unit = msg.TurbidityUnit
+	}
+	if len(msg.Timestamp) > 0 && string(msg.Timestamp) != "null" {
+		var err error
+		r.Timestamp, err = parseTimestamp(strings.Trim(string(msg.Timestamp), `"`))
+		return err
+	}
+	return nil
+}
+
+// parseMeasurement reads a number with an optional unit suffix such as "315.4NTU"
+func parseMeasurement(s, defaultUnit string) (Measurement, error) {
+	s = strings.TrimSpace(s)
+	end := len(s)
+	for i, c := range s {
+		if !strings.ContainsRune("0123456789.+-eE", c) {
+			end = i
+			break
+		}
+	}
+	value, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("invalid value %q", s)
+	}
+	unit := strings.TrimSpace(s[end:])
+	if unit == "" {
+		unit = defaultUnit
+	}
+	return Measurement{Value: value, Unit: unit}, nil
+}
+
+// parseTimestamp accepts unix seconds, unix milliseconds or RFC 3339
+func parseTimestamp(s string) (time.Time, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return t, nil
+}
+
+type lineResult struct {
+	reading Reading
+	err     error
+}
+
+// lineSource reads a line protocol from a device in the background. Probes usually
+// stream faster than the daemon submits, so Read returns the newest reading.
+type lineSource struct {
+	opts    Options
+	results chan lineResult
+	done    chan struct{}
+
+	mu      sync.Mutex
+	current io.Closer
+	closed  bool
+}
+
+func newLineSource(opts Options) *lineSource {
+	return &lineSource{
+		opts:    opts,
+		results: make(chan lineResult, 16),
+		done:    make(chan struct{}),
+	}
+}
+
+// start keeps reading from whatever open returns, reopening it after errors or EOF
+func (s *lineSource) start(open func() (io.ReadCloser, error)) {
+	go s.run(open)
+}
+
+func (s *lineSource) run(open func() (io.ReadCloser, error)) {
+	for {
+		r, err := open()
+		if err != nil {
+			s.publish(lineResult{err: err})
+		} else if s.setCurrent(r) {
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				line := strings.TrimSpace(scanner.Text())
+				if line == "" || strings.HasPrefix(line, "#") {
+					continue
+				}
+				reading, err := parseLine(s.opts.Protocol, line, s.opts)
+				s.publish(lineResult{reading: reading, err: err})
+			}
+			r.Close()
+			if err := scanner.Err(); err != nil && !s.isClosed() {
+				s.publish(lineResult{err: err})
+			}
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-time.After(reopenDelay):
+		}
+	}
+}
+
+// publish queues a result, dropping the oldest one when the reader falls behind
+func (s *lineSource) publish(res lineResult) {
+	for {
+		select {
+		case s.results <- res:
+			return
+		default:
+		}
+		select {
+		case <-s.results:
+		default:
+		}
+	}
+}
+
+func (s *lineSource) setCurrent(c io.Closer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return false
+	}
+	s.current = c
+	return true
+}
+
+func (s *lineSource) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+func (s *lineSource) Read(ctx context.Context) (Reading, error) {
+	var res lineResult
+	select {
+	case res = <-s.results:
+	case <-ctx.Done():
+		return Reading{}, ctx.Err()
+	case <-s.done:
+		return Reading{}, errors.New("sensor is closed")
+	}
+
+	// Skip to the newest complete reading
+	for {
+		select {
+		case next := <-s.results:
+			if next.err == nil || res.err != nil {
+				res = next
+			}
+			continue
+		default:
+		}
+		return res.reading, res.err
+	}
+}
+
+func (s *lineSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	if s.current != nil {
+		return s.current.Close()
+	}
+	return nil
+}
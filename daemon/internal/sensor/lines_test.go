@@ -0,0 +1,66 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	opts := Options{PHUnit: UnitPH, TurbidityUnit: UnitNTU}
+	ts := time.Unix(1718000000, 0)
+
+	tests := []struct {
+		name     string
+		protocol string
+		line     string
+		want     Reading // a zero Timestamp means the time of parsing
+		wantErr  bool
+	}{
+		{"csv", ProtocolCSV, "7.12,315.4", Reading{PH: Measurement{7.12, UnitPH}, Turbidity: Measurement{315.4, UnitNTU}}, false},
+		{"csv is the default", "", "7.12, 315.4", Reading{PH: Measurement{7.12, UnitPH}, Turbidity: Measurement{315.4, UnitNTU}}, false},
+		{"csv with unix seconds", ProtocolCSV, "7.12,315.4,1718000000", Reading{Timestamp: ts, PH: Measurement{7.12, UnitPH}, Turbidity: Measurement{315.4, UnitNTU}}, false},
+		{"csv with unix milliseconds", ProtocolCSV, "7,3,1718000000000", Reading{Timestamp: ts, PH: Measurement{7, UnitPH}, Turbidity: Measurement{3, UnitNTU}}, false},
+		{"csv with units", ProtocolCSV, "7.1pH,12FNU", Reading{PH: Measurement{7.1, UnitPH}, Turbidity: Measurement{12, "FNU"}}, false},
+		{"csv missing turbidity", ProtocolCSV, "7.12", Reading{}, true},
+		{"csv too many fields", ProtocolCSV, "7,1,2,3", Reading{}, true},
+		{"csv not a number", ProtocolCSV, "seven,1", Reading{}, true},
+		{"csv bad timestamp", ProtocolCSV, "7,1,yesterday", Reading{}, true},
+		{"kv", ProtocolKV, "ph=7.12 turbidity=315.4NTU ts=2024-06-10T06:13:20Z", Reading{Timestamp: ts, PH: Measurement{7.12, UnitPH}, Turbidity: Measurement{315.4, UnitNTU}}, false},
+		{"kv aliases and separators", ProtocolKV, "PH=6.5;ntu=2,time=1718000000", Reading{Timestamp: ts, PH: Measurement{6.5, UnitPH}, Turbidity: Measurement{2, UnitNTU}}, false},
+		{"kv ignores unknown keys", ProtocolKV, "temp=21 ph=7 turb=1", Reading{PH: Measurement{7, UnitPH}, Turbidity: Measurement{1, UnitNTU}}, false},
+		{"kv missing ph", ProtocolKV, "turbidity=1", Reading{}, true},
+		{"kv without equals", ProtocolKV, "ph 7 turbidity 1", Reading{}, true},
+		{"json", ProtocolJSON, `{"ph":7.12,"turbidity":315.4,"turbidity_unit":"FNU","timestamp":1718000000}`, Reading{Timestamp: ts, PH: Measurement{7.12, UnitPH}, Turbidity: Measurement{315.4, "FNU"}}, false},
+		{"json with RFC 3339 timestamp", ProtocolJSON, `{"ph":7,"turbidity":1,"timestamp":"2024-06-10T06:13:20Z"}`, Reading{Timestamp: ts, PH: Measurement{7, UnitPH}, Turbidity: Measurement{1, UnitNTU}}, false},
+		{"json null timestamp", ProtocolJSON, `{"ph":7,"turbidity":0,"timestamp":null}`, Reading{PH: Measurement{7, UnitPH}, Turbidity: Measurement{0, UnitNTU}}, false},
+		{"json missing turbidity", ProtocolJSON, `{"ph":7}`, Reading{}, true},
+		{"json malformed", ProtocolJSON, `{"ph":7,`, Reading{}, true},
+		{"unknown protocol", "xml", "<ph>7</ph>", Reading{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			got, err := parseLine(tt.protocol, tt.line, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLine(%q) = %+v, want an error", tt.line, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLine(%q) failed: %v", tt.line, err)
+			}
+
+			if tt.want.Timestamp.IsZero() {
+				if got.Timestamp.Before(before) || got.Timestamp.After(time.Now()) {
+					t.Errorf("timestamp %s is not the time of parsing", got.Timestamp)
+				}
+			} else if !got.Timestamp.Equal(tt.want.Timestamp) {
+				t.Errorf("timestamp = %s, want %s", got.Timestamp, tt.want.Timestamp)
+			}
+			if got.PH != tt.want.PH || got.Turbidity != tt.want.Turbidity {
+				t.Errorf("parseLine(%q) = pH %+v, turbidity %+v, want %+v, %+v", tt.line, got.PH, got.Turbidity, tt.want.PH, tt.want.Turbidity)
+			}
+		})
+	}
+}
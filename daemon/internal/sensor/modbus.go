@@ -0,0 +1,289 @@
+package sensor
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"time"
+)
+
+// Modbus function codes used by the driver
+const (
+	modbusReadHolding = 0x03
+	modbusReadInput   = 0x04
+)
+
+// modbusTimeout bounds one request/response exchange
+const modbusTimeout = 2 * time.Second
+
+// modbusTransport exchanges one protocol data unit with a device
+type modbusTransport interface {
+	transact(ctx context.Context, unit byte, pdu []byte) ([]byte, error)
+	Close() error
+}
+
+// modbusSensor polls the pH and turbidity registers of a Modbus probe
+type modbusSensor struct {
+	opts      Options
+	transport modbusTransport
+	function  byte
+	words     uint16
+}
+
+func newModbusSensor(opts Options, transport modbusTransport) (Sensor, error) {
+	s := &modbusSensor{opts: opts, transport: transport}
+
+	switch opts.ModbusRegisterType {
+	case "", "holding":
+		s.function = modbusReadHolding
+	case "input":
+		s.function = modbusReadInput
+	default:
+		return nil, fmt.Errorf("unknown modbus register type %q", opts.ModbusRegisterType)
+	}
+
+	switch opts.ModbusDataType {
+	case "", "uint16", "int16":
+		s.words = 1
+	case "float32":
+		s.words = 2
+	default:
+		return nil, fmt.Errorf("unknown modbus data type %q", opts.ModbusDataType)
+	}
+
+	if s.opts.ModbusUnitID == 0 {
+		s.opts.ModbusUnitID = 1
+	}
+	if s.opts.PHScale == 0 {
+		s.opts.PHScale = 1
+	}
+	if s.opts.TurbidityScale == 0 {
+		s.opts.TurbidityScale = 1
+	}
+	return s, nil
+}
+
+func (s *modbusSensor) Read(ctx context.Context) (Reading, error) {
+	ph, err := s.readValue(ctx, s.opts.PHRegister)
+	if err != nil {
+		return Reading{}, fmt.Errorf("failed to read pH register %d: %w", s.opts.PHRegister, err)
+	}
+	turbidity, err := s.readValue(ctx, s.opts.TurbidityRegister)
+	if err != nil {
+		return Reading{}, fmt.Errorf("failed to read turbidity register %d: %w", s.opts.TurbidityRegister, err)
+	}
+
+	return Reading{
+		Timestamp: time.Now(),
+		PH:        Measurement{Value: ph * s.opts.PHScale, Unit: s.opts.PHUnit},
+		Turbidity: Measurement{Value: turbidity * s.opts.TurbidityScale, Unit: s.opts.TurbidityUnit},
+	}, nil
+}
+
+func (s *modbusSensor) readValue(ctx context.Context, register uint16) (float64, error) {
+	pdu := make([]byte, 5)
+	pdu[0] = s.function
+	binary.BigEndian.PutUint16(pdu[1:], register)
+	binary.BigEndian.PutUint16(pdu[3:], s.words)
+
+	resp, err := s.transport.transact(ctx, s.opts.ModbusUnitID, pdu)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkModbusResponse(resp, s.function); err != nil {
+		return 0, err
+	}
+	if int(resp[1]) != 2*int(s.words) || len(resp) != 2+2*int(s.words) {
+		return 0, fmt.Errorf("unexpected response length %d", len(resp))
+	}
+
+	data := resp[2:]
+	switch s.opts.ModbusDataType {
+	case "int16":
+		return float64(int16(binary.BigEndian.Uint16(data))), nil
+	case "float32":
+		// Big-endian word order, the most common layout for IEEE 754 values
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	default:
+		return float64(binary.BigEndian.Uint16(data)), nil
+	}
+}
+
+func checkModbusResponse(resp []byte, function byte) error {
+	if len(resp) < 2 {
+		return fmt.Errorf("short response of %d bytes", len(resp))
+	}
+	if resp[0] == function|0x80 {
+		return fmt.Errorf("device returned exception code %d", resp[1])
+	}
+	if resp[0] != function {
+		return fmt.Errorf("unexpected function code 0x%02x in response", resp[0])
+	}
+	return nil
+}
+
+func (s *modbusSensor) Close() error {
+	return s.transport.Close()
+}
+
+func deadline(ctx context.Context) time.Time {
+	d := time.Now().Add(modbusTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(d) {
+		return ctxDeadline
+	}
+	return d
+}
+
+// modbusTCP speaks Modbus TCP, reconnecting lazily after errors
+type modbusTCP struct {
+	address string
+	conn    net.Conn
+	txID    uint16
+}
+
+func (m *modbusTCP) transact(ctx context.Context, unit byte, pdu []byte) ([]byte, error) {
+	if m.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", m.address)
+		if err != nil {
+			return nil, err
+		}
+		m.conn = conn
+	}
+
+	resp, err := m.exchange(ctx, unit, pdu)
+	if err != nil {
+		m.conn.Close()
+		m.conn = nil
+	}
+	return resp, err
+}
+
+func (m *modbusTCP) exchange(ctx context.Context, unit byte, pdu []byte) ([]byte, error) {
+	if err := m.conn.SetDeadline(deadline(ctx)); err != nil {
+		return nil, err
+	}
+
+	m.txID++
+	// MBAP header: transaction id, protocol id (0), length of unit id + PDU, unit id
+	frame := make([]byte, 7, 7+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], m.txID)
+	binary.BigEndian.PutUint16(frame[4:], uint16(len(pdu)+1))
+	frame[6] = unit
+	frame = append(frame, pdu...)
+	if _, err := m.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(m.conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if binary.BigEndian.Uint16(header[0:]) != m.txID || binary.BigEndian.Uint16(header[2:]) != 0 || length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid MBAP header % x", header)
+	}
+
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(m.conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (m *modbusTCP) Close() error {
+	if m.conn == nil {
+		return nil
+	}
+	return m.conn.Close()
+}
+
+// modbusRTU speaks Modbus RTU over a serial line
+type modbusRTU struct {
+	port string
+	baud int
+	f    *os.File
+}
+
+func (m *modbusRTU) transact(ctx context.Context, unit byte, pdu []byte) ([]byte, error) {
+	if m.f == nil {
+		baud := m.baud
+		if baud == 0 {
+			baud = DefaultBaud
+		}
+		f, err := openSerial(m.port, baud)
+		if err != nil {
+			return nil, err
+		}
+		m.f = f
+	}
+
+	resp, err := m.exchange(ctx, unit, pdu)
+	if err != nil {
+		m.f.Close()
+		m.f = nil
+	}
+	return resp, err
+}
+
+func (m *modbusRTU) exchange(ctx context.Context, unit byte, pdu []byte) ([]byte, error) {
+	if err := m.f.SetDeadline(deadline(ctx)); err != nil {
+		return nil, err
+	}
+
+	frame := append([]byte{unit}, pdu...)
+	frame = binary.LittleEndian.AppendUint16(frame, crc16(frame))
+	if _, err := m.f.Write(frame); err != nil {
+		return nil, err
+	}
+
+	// Address, function and either the byte count or the exception code
+	resp := make([]byte, 3, 256)
+	if _, err := io.ReadFull(m.f, resp); err != nil {
+		return nil, err
+	}
+	rest := 2 // CRC
+	if resp[1]&0x80 == 0 {
+		rest += int(resp[2])
+	}
+	resp = resp[:3+rest]
+	if _, err := io.ReadFull(m.f, resp[3:]); err != nil {
+		return nil, err
+	}
+
+	body, sum := resp[:len(resp)-2], binary.LittleEndian.Uint16(resp[len(resp)-2:])
+	if crc16(body) != sum {
+		return nil, fmt.Errorf("CRC mismatch in response % x", resp)
+	}
+	if body[0] != unit {
+		return nil, fmt.Errorf("response from unit %d, expected %d", body[0], unit)
+	}
+	return body[1:], nil
+}
+
+func (m *modbusRTU) Close() error {
+	if m.f == nil {
+		return nil
+	}
+	return m.f.Close()
+}
+
+// crc16 is the Modbus CRC (polynomial 0xA001, initial value 0xFFFF)
+func crc16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for range 8 {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
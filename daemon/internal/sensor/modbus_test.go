@@ -0,0 +1,23 @@
+package sensor
+
+import "testing"
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want uint16
+	}{
+		{"check value", []byte("123456789"), 0x4B37},
+		// Read one holding register at address 0 of unit 1, sent as 84 0A
+		{"read request", []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, 0x0A84},
+		{"empty", nil, 0xFFFF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16(tt.data); got != tt.want {
+				t.Errorf("crc16(% x) = %#04x, want %#04x", tt.data, got, tt.want)
+			}
+		})
+	}
+}
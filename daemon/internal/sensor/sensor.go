@@ -0,0 +1,132 @@
+package sensor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Supported drivers
+const (
+	DriverSimulator = "simulator"
+	DriverSerial    = "serial"
+	DriverModbusRTU = "modbus-rtu"
+	DriverModbusTCP = "modbus-tcp"
+	DriverFile      = "file"
+)
+
+// Default units, used when neither the device nor the config names one
+const (
+	UnitPH  = "pH"
+	UnitNTU = "NTU"
+)
+
+// MaxClockDrift is how far a reading may be timestamped ahead of now. The contract
+// rejects readings further in the future, see MAX_CLOCK_DRIFT in Log.sol.
+const MaxClockDrift = 5 * time.Minute
+
+// Measurement is a single value together with the unit it was reported in
+type Measurement struct {
+	Value float64
+	Unit  string
+}
+
+// Reading is one sample of the probe, timestamped when it was taken
+type Reading struct {
+	Timestamp time.Time
+	PH        Measurement
+	Turbidity Measurement
+}
+
+// Validate rejects readings the contract cannot store or that are physically impossible
+func (r Reading) Validate() error {
+	if r.PH.Unit != UnitPH {
+		return fmt.Errorf("unsupported pH unit %q", r.PH.Unit)
+	}
+	// FNU and NTU are numerically equivalent for our purposes
+	if r.Turbidity.Unit != UnitNTU && r.Turbidity.Unit != "FNU" {
+		return fmt.Errorf("unsupported turbidity unit %q", r.Turbidity.Unit)
+	}
+	if math.IsNaN(r.PH.Value) || r.PH.Value < 0 || r.PH.Value > 14 {
+		return fmt.Errorf("pH %v is out of range 0-14", r.PH.Value)
+	}
+	if math.IsNaN(r.Turbidity.Value) || r.Turbidity.Value < 0 {
+		return fmt.Errorf("turbidity %v is negative", r.Turbidity.Value)
+	}
+	if ahead := time.Until(r.Timestamp); ahead > MaxClockDrift {
+		return fmt.Errorf("timestamp %s is %s in the future", r.Timestamp.Format(time.RFC3339), ahead.Round(time.Second))
+	}
+	return nil
+}
+
+// Sensor is a water quality probe
+type Sensor interface {
+	// Read returns the next reading, waiting for the device if needed
+	Read(ctx context.Context) (Reading, error)
+	Close() error
+}
+
+// Options selects and configures a driver
+type Options struct {
+	Driver string
+
+	// Serial line protocol (serial) and Modbus RTU
+	Port     string
+	Baud     int
+	Protocol string // line protocol: csv, kv or json
+
+	// File or named pipe
+	Path string
+
+	// Modbus
+	ModbusAddress      string // host:port for Modbus TCP
+	ModbusUnitID       byte
+	ModbusRegisterType string // holding or input
+	ModbusDataType     string // uint16, int16 or float32
+	PHRegister         uint16
+	TurbidityRegister  uint16
+	PHScale            float64
+	TurbidityScale     float64
+
+	// Units assumed when the device does not report them
+	PHUnit        string
+	TurbidityUnit string
+}
+
+// New opens the configured driver
+func New(opts Options) (Sensor, error) {
+	if opts.PHUnit == "" {
+		opts.PHUnit = UnitPH
+	}
+	if opts.TurbidityUnit == "" {
+		opts.TurbidityUnit = UnitNTU
+	}
+
+	switch opts.Driver {
+	case "", DriverSimulator:
+		return NewSimulator(opts), nil
+	case DriverSerial:
+		if opts.Port == "" {
+			return nil, fmt.Errorf("serial sensor needs a port")
+		}
+		return newSerialSensor(opts)
+	case DriverFile:
+		if opts.Path == "" {
+			return nil, fmt.Errorf("file sensor needs a path")
+		}
+		return newFileSensor(opts)
+	case DriverModbusRTU:
+		if opts.Port == "" {
+			return nil, fmt.Errorf("modbus-rtu sensor needs a port")
+		}
+		return newModbusSensor(opts, &modbusRTU{port: opts.Port, baud: opts.Baud})
+	case DriverModbusTCP:
+		if opts.ModbusAddress == "" {
+			return nil, fmt.Errorf("modbus-tcp sensor needs an address")
+		}
+		return newModbusSensor(opts, &modbusTCP{address: opts.ModbusAddress})
+	default:
+		return nil, fmt.Errorf("unknown sensor driver %q", opts.Driver)
+	}
+}
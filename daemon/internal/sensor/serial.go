@@ -0,0 +1,31 @@
+package sensor
+
+import (
+	"io"
+)
+
+// DefaultBaud is used when no baud rate is configured
+const DefaultBaud = 9600
+
+// newSerialSensor reads a line protocol from a UART probe
+func newSerialSensor(opts Options) (Sensor, error) {
+	if opts.Baud == 0 {
+		opts.Baud = DefaultBaud
+	}
+	// Fail early on a missing device or unsupported baud rate
+	port, err := openSerial(opts.Port, opts.Baud)
+	if err != nil {
+		return nil, err
+	}
+
+	src := newLineSource(opts)
+	src.start(func() (io.ReadCloser, error) {
+		if port != nil {
+			p := port
+			port = nil
+			return p, nil
+		}
+		return openSerial(opts.Port, opts.Baud)
+	})
+	return src, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package sensor
+
+import (
+	"errors"
+	"os"
+)
+
+func openSerial(port string, baud int) (*os.File, error) {
+	return nil, errors.New("serial ports are only supported on linux")
+}
@@ -0,0 +1,46 @@
+package sensor
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Simulator produces plausible readings that drift slowly, for tests and demos
+type Simulator struct {
+	rng       *rand.Rand
+	opts      Options
+	ph        float64
+	turbidity float64
+}
+
+func NewSimulator(opts Options) *Simulator {
+	return &Simulator{
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		opts:      opts,
+		ph:        7.5,
+		turbidity: 350,
+	}
+}
+
+func (s *Simulator) Read(ctx context.Context) (Reading, error) {
+	if err := ctx.Err(); err != nil {
+		return Reading{}, err
+	}
+	s.ph = clamp(s.ph+s.rng.NormFloat64()*0.1, 6.5, 9)
+	s.turbidity = clamp(s.turbidity+s.rng.NormFloat64()*10, 200, 450)
+
+	return Reading{
+		Timestamp: time.Now(),
+		PH:        Measurement{Value: s.ph, Unit: s.opts.PHUnit},
+		Turbidity: Measurement{Value: s.turbidity, Unit: s.opts.TurbidityUnit},
+	}, nil
+}
+
+func (s *Simulator) Close() error {
+	return nil
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,100 @@
+package status
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labels = []string{"profile", "address"}
+
+var (
+	infoDesc = prometheus.NewDesc("p2m_daemon_info", "Version of the daemon.", []string{"version"}, nil)
+
+	authenticatedDesc = prometheus.NewDesc("p2m_authenticated", "Whether the recorder has a valid API session.", labels, nil)
+	sessionExpiryDesc = prometheus.NewDesc("p2m_session_expiry_timestamp_seconds", "When the API session expires.", labels, nil)
+
+	takenDesc        = prometheus.NewDesc("p2m_readings_taken_total", "Valid readings taken from the sensor.", labels, nil)
+	sensorErrorsDesc = prometheus.NewDesc("p2m_sensor_errors_total", "Failed or invalid sensor reads.", labels, nil)
+	submittedDesc    = prometheus.NewDesc("p2m_readings_submitted_total", "Readings stored on chain.", labels, nil)
+	submitErrorsDesc = prometheus.NewDesc("p2m_submit_errors_total", "Failed attempts to store readings on chain.", labels, nil)
+
+	lastReadingDesc   = prometheus.NewDesc("p2m_last_reading_timestamp_seconds", "When the latest reading was taken.", labels, nil)
+	lastPHDesc        = prometheus.NewDesc("p2m_last_reading_ph", "pH of the latest reading.", labels, nil)
+	lastTurbidityDesc = prometheus.NewDesc("p2m_last_reading_turbidity", "Turbidity of the latest reading.", labels, nil)
+	lastTxDesc        = prometheus.NewDesc("p2m_last_tx_timestamp_seconds", "When readings were last stored on chain.", labels, nil)
+
+	queueDepthDesc   = prometheus.NewDesc("p2m_queue_depth", "Readings waiting to be stored on chain.", labels, nil)
+	queueAgeDesc     = prometheus.NewDesc("p2m_queue_oldest_age_seconds", "Age of the oldest queued reading.", labels, nil)
+	queueDroppedDesc = prometheus.NewDesc("p2m_queue_dropped_total", "Readings dropped by the queue limits.", labels, nil)
+
+	rpcUpDesc   = prometheus.NewDesc("p2m_rpc_up", "Whether the RPC endpoint is connected, for direct submission.", labels, nil)
+	balanceDesc = prometheus.NewDesc("p2m_wallet_balance_wei", "Balance of the device key, for direct submission.", labels, nil)
+)
+
+// collector turns recorder snapshots into metrics when Prometheus scrapes. It is
+// unchecked (describes nothing) so registering it does not query the recorders.
+type collector struct {
+	server *Server
+}
+
+func (c *collector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1, c.server.version)
+
+	now := time.Now()
+	for _, s := range c.server.snapshots(context.Background()) {
+		values := []string{s.Profile, s.Address}
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, values...)
+		}
+		counter := func(desc *prometheus.Desc, v uint64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v), values...)
+		}
+
+		gauge(authenticatedDesc, boolValue(s.Authenticated))
+		if s.SessionExpiresAt != nil {
+			gauge(sessionExpiryDesc, float64(s.SessionExpiresAt.Unix()))
+		}
+
+		counter(takenDesc, s.ReadingsTaken)
+		counter(sensorErrorsDesc, s.SensorErrors)
+		counter(submittedDesc, s.ReadingsSubmitted)
+		counter(submitErrorsDesc, s.SubmitErrors)
+
+		if s.LastReading != nil {
+			gauge(lastReadingDesc, float64(s.LastReading.Timestamp.Unix()))
+			gauge(lastPHDesc, s.LastReading.PH)
+			gauge(lastTurbidityDesc, s.LastReading.Turbidity)
+		}
+		if s.LastTx != nil {
+			gauge(lastTxDesc, float64(s.LastTx.At.Unix()))
+		}
+
+		gauge(queueDepthDesc, float64(s.Queue.Depth))
+		age := 0.0
+		if s.Queue.Oldest != nil {
+			age = now.Sub(*s.Queue.Oldest).Seconds()
+		}
+		gauge(queueAgeDesc, age)
+		counter(queueDroppedDesc, s.Queue.Dropped)
+
+		if s.RPC != nil {
+			gauge(rpcUpDesc, boolValue(s.RPC.Connected))
+			if balance, ok := new(big.Float).SetString(s.RPC.BalanceWei); ok {
+				wei, _ := balance.Float64()
+				gauge(balanceDesc, wei)
+			}
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+// Package status serves what the daemon is doing over local HTTP: /healthz for
+// supervisors, /status for technicians and /metrics for Prometheus.
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// snapshotTimeout bounds the RPC calls (such as the balance) behind one request
+const snapshotTimeout = 5 * time.Second
+
+type Reading struct {
+	PH            float64   `json:"ph"`
+	PHUnit        string    `json:"ph_unit"`
+	Turbidity     float64   `json:"turbidity"`
+	TurbidityUnit string    `json:"turbidity_unit"`
+	Timestamp     time.Time `json:"timestamp"`
+}
+
+// Tx is the latest transaction that stored readings on chain
+type Tx struct {
+	Hash     string    `json:"hash"`
+	Readings int       `json:"readings"`
+	At       time.Time `json:"at"`
+}
+
+type Queue struct {
+	Depth   int        `json:"depth"`
+	Oldest  *time.Time `json:"oldest,omitempty"`
+	Dropped uint64     `json:"dropped"`
+}
+
+// RPC is the connection of a recorder that submits its own transactions
+type RPC struct {
+	Connected bool   `json:"connected"`
+	ChainID   string `json:"chain_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+
+	BalanceWei   string `json:"balance_wei,omitempty"`
+	BalanceError string `json:"balance_error,omitempty"`
+}
+
+// Snapshot is the state of one recorder
+type Snapshot struct {
+	Profile    string `json:"profile"`
+	Address    string `json:"address"`
+	SubmitMode string `json:"submit_mode"`
+
+	Authenticated    bool       `json:"authenticated"`
+	SessionExpiresAt *time.Time `json:"session_expires_at,omitempty"`
+	AuthError        string     `json:"auth_error,omitempty"`
+
+	LastReading     *Reading `json:"last_reading,omitempty"`
+	LastTx          *Tx      `json:"last_tx,omitempty"`
+	LastSubmitError string   `json:"last_submit_error,omitempty"`
+
+	ReadingsTaken     uint64 `json:"readings_taken"`
+	SensorErrors      uint64 `json:"sensor_errors"`
+	ReadingsSubmitted uint64 `json:"readings_submitted"`
+	SubmitErrors      uint64 `json:"submit_errors"`
+
+	Queue Queue `json:"queue"`
+	// RPC is nil in relay mode, where the API submits transactions
+	RPC *RPC `json:"rpc,omitempty"`
+}
+
+// Problems lists why a recorder cannot get readings on chain right now
+func (s Snapshot) Problems() []string {
+	var problems []string
+	if !s.Authenticated {
+		problem := "not authenticated with the API"
+		if s.AuthError != "" {
+			problem += ": " + s.AuthError
+		}
+		problems = append(problems, problem)
+	}
+	if s.RPC != nil && !s.RPC.Connected {
+		problem := "RPC endpoint unreachable"
+		if s.RPC.Error != "" {
+			problem += ": " + s.RPC.Error
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// Recorder is a daemon profile the server reports on
+type Recorder interface {
+	Status(ctx context.Context) Snapshot
+}
+
+type Server struct {
+	version   string
+	startedAt time.Time
+	recorders []Recorder
+	server    *http.Server
+}
+
+// NewServer prepares a status server for recorders on addr, such as 127.0.0.1:9100.
+// The endpoints are unauthenticated, so addr should not be reachable from untrusted networks.
+func NewServer(addr, version string, recorders []Recorder) *Server {
+	s := &Server{version: version, startedAt: time.Now(), recorders: recorders}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&collector{server: s},
+	)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /status", s.status)
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Start listens on the address right away, so a port in use is reported, and serves in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	log.Printf("Status: Serving /healthz, /status and /metrics on http://%s", listener.Addr())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Status: Server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops listening and waits for requests being served
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) snapshots(ctx context.Context) []Snapshot {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+
+	snapshots := make([]Snapshot, len(s.recorders))
+	for i, r := range s.recorders {
+		snapshots[i] = r.Status(ctx)
+	}
+	return snapshots
+}
+
+func (s *Server) healthz(w http.ResponseWriter, req *http.Request) {
+	problems := make(map[string][]string)
+	for _, snapshot := range s.snapshots(req.Context()) {
+		if p := snapshot.Problems(); len(p) > 0 {
+			problems[snapshot.Address] = p
+		}
+	}
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unhealthy", "problems": problems})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) status(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version":        s.version,
+		"started_at":     s.startedAt,
+		"uptime_seconds": int64(time.Since(s.startedAt).Seconds()),
+		"recorders":      s.snapshots(req.Context()),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(body); err != nil {
+		log.Printf("Status: Failed to write response: %v", err)
+	}
+}
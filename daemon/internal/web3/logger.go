@@ -1,45 +1,455 @@
 package web3
 
 import (
+	"bytes"
 	"context"
 	"crypto/ecdsa"
+	"errors"
 	"fmt"
+	"log"
 	"math/big"
-	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/p2m-lite/core/daemon/internal/contract"
 )
 
-func SendLog(cAddr string, key *ecdsa.PrivateKey, ph, turbidity int) error {
-	pk := key.Public()
-	pubAddress := common.HexToAddress(crypto.PubkeyToAddress(*pk.(*ecdsa.PublicKey)).Hex())
-	fmt.Println("Sending log to blockchain via pub-address:", pubAddress.Hex())
-	
-	client, cErr := ethclient.Dial(os.Getenv("BLOCKCHAIN_URL"))
-	if cErr != nil {
-		return cErr
+const (
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+
+	// ReceiptTimeout bounds how long a send waits for its transaction to be
+	// mined. The same readings sent again wait for that transaction first.
+	ReceiptTimeout = 2 * time.Minute
+	// HealthInterval is how often Watch checks the RPC endpoint
+	HealthInterval = 30 * time.Second
+)
+
+// ErrUnavailable means the RPC endpoint could not be reached, the send can be retried later
+var ErrUnavailable = errors.New("RPC endpoint unavailable")
+
+// RevertError is returned when the contract rejects a log transaction. Reason is the
+// require message when the node reports it. TxHash is zero when the revert was
+// caught while estimating gas, before anything was sent.
+type RevertError struct {
+	Method string
+	Reason string
+	TxHash common.Hash
+}
+
+func (e *RevertError) Error() string {
+	msg := e.Method + " reverted"
+	if e.TxHash != (common.Hash{}) {
+		msg += " in " + e.TxHash.Hex()
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Network is the chain log transactions are sent to
+type Network struct {
+	RPCURL string
+	// ChainID guards against an RPC endpoint of the wrong chain, nil accepts any
+	ChainID *big.Int
+}
+
+// FeeOptions controls the EIP-1559 fees of log transactions. Nil caps are not enforced.
+type FeeOptions struct {
+	MaxFeePerGas     *big.Int
+	MaxTipPerGas     *big.Int
+	GasMarginPercent int
+}
+
+// Logger sends the readings of one device key to the contract over a long-lived
+// RPC connection. It tracks the account nonce locally, reconnects with backoff
+// after connection failures and waits for every transaction to be mined.
+type Logger struct {
+	network  Network
+	contract common.Address
+	key      *ecdsa.PrivateKey
+	from     common.Address
+	fees     FeeOptions
+	abi      *abi.ABI
+
+	// mu guards the connection, which is dialed lazily
+	mu       sync.Mutex
+	client   *ethclient.Client
+	chainID  *big.Int
+	failures int
+	retryAt  time.Time
+	lastErr  error
+
+	// sendMu serializes sends, it guards the nonce and the unconfirmed transaction
+	sendMu  sync.Mutex
+	nonce   *uint64
+	pending *types.Transaction
+}
+
+func NewLogger(network Network, cAddr string, key *ecdsa.PrivateKey, fees FeeOptions) (*Logger, error) {
+	parsed, err := contract.P2MContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{
+		network:  network,
+		contract: common.HexToAddress(cAddr),
+		key:      key,
+		from:     crypto.PubkeyToAddress(key.PublicKey),
+		fees:     fees,
+		abi:      parsed,
+	}, nil
+}
+
+func (l *Logger) SendLog(ctx context.Context, ph, turbidity int) (*types.Receipt, error) {
+	return l.send(ctx, "storeLog", big.NewInt(int64(ph)), big.NewInt(int64(turbidity)))
+}
+
+// SendLogs submits several readings in one storeLogs transaction. The slices must have equal length.
+func (l *Logger) SendLogs(ctx context.Context, ph, turbidity []int, timestamps []time.Time) (*types.Receipt, error) {
+	if len(turbidity) != len(ph) || len(timestamps) != len(ph) {
+		return nil, errors.New("batch slices must have the same length")
+	}
+
+	phValues := make([]*big.Int, len(ph))
+	turbidityValues := make([]*big.Int, len(ph))
+	timestampValues := make([]*big.Int, len(ph))
+	for i := range ph {
+		phValues[i] = big.NewInt(int64(ph[i]))
+		turbidityValues[i] = big.NewInt(int64(turbidity[i]))
+		timestampValues[i] = big.NewInt(timestamps[i].Unix())
+	}
+	return l.send(ctx, "storeLogs", phValues, turbidityValues, timestampValues)
+}
+
+// Health checks that the RPC endpoint answers, connecting first if needed
+func (l *Logger) Health(ctx context.Context) error {
+	client, _, err := l.conn(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := client.BlockNumber(ctx); err != nil {
+		l.fail(ctx, client, err)
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return nil
+}
+
+// State reports the connection without dialing: whether it is up, the chain it
+// is on and why the latest attempt failed
+func (l *Logger) State() (connected bool, chainID *big.Int, lastErr error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.client != nil, l.chainID, l.lastErr
+}
+
+// Balance returns the balance of the device key, which pays for log transactions
+func (l *Logger) Balance(ctx context.Context) (*big.Int, error) {
+	client, _, err := l.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := client.BalanceAt(ctx, l.from, nil)
+	if err != nil {
+		l.fail(ctx, client, err)
+		return nil, fmt.Errorf("failed to fetch balance: %w", err)
+	}
+	return balance, nil
+}
+
+// Watch checks the RPC endpoint every interval so an outage is noticed and
+// repaired between readings. It returns when ctx is cancelled.
+func (l *Logger) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy := true
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := l.Health(checkCtx)
+		cancel()
+		if err != nil && healthy {
+			log.Printf("Web3: RPC endpoint is unhealthy: %v", err)
+		} else if err == nil && !healthy {
+			log.Println("Web3: RPC endpoint is healthy again")
+		}
+		healthy = err == nil
+	}
+}
+
+// Close drops the connection, a later send dials again
+func (l *Logger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client != nil {
+		l.client.Close()
+		l.client = nil
+	}
+}
+
+// conn returns the connection and its chain ID, dialing when there is none.
+// Failed dials back off exponentially so an outage is not hammered.
+func (l *Logger) conn(ctx context.Context) (*ethclient.Client, *big.Int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client != nil {
+		return l.client, l.chainID, nil
+	}
+	if wait := time.Until(l.retryAt); wait > 0 {
+		return nil, nil, fmt.Errorf("%w, next attempt in %s: %v", ErrUnavailable, wait.Round(time.Second), l.lastErr)
 	}
-	defer client.Close()
 
-	chainID, nErr := client.NetworkID(context.Background())
-	if nErr != nil {
-		return nErr
+	client, chainID, err := l.dial(ctx)
+	if err != nil {
+		delay := maxReconnectDelay
+		if l.failures < 6 {
+			delay = min(minReconnectDelay<<l.failures, maxReconnectDelay)
+		}
+		l.failures++
+		l.retryAt = time.Now().Add(delay)
+		l.lastErr = err
+		return nil, nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
 	}
 
-	address := common.HexToAddress(cAddr)
-	instance, iErr := contract.NewP2MContract(address, client)
-	if iErr != nil {
-		return iErr
+	if l.failures > 0 {
+		log.Printf("Web3: Reconnected to chain %s after %d failed attempts", chainID, l.failures)
 	}
-	auth, tErr := bind.NewKeyedTransactorWithChainID(key, chainID)
-	if tErr != nil {
-		return tErr
+	l.client, l.chainID, l.failures, l.lastErr = client, chainID, 0, nil
+	return client, chainID, nil
+}
+
+func (l *Logger) dial(ctx context.Context) (*ethclient.Client, *big.Int, error) {
+	client, err := ethclient.DialContext(ctx, l.network.RPCURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to fetch chain id: %w", err)
+	}
+	if l.network.ChainID != nil && chainID.Cmp(l.network.ChainID) != 0 {
+		client.Close()
+		return nil, nil, fmt.Errorf("RPC endpoint is on chain %s, not the configured chain %s", chainID, l.network.ChainID)
+	}
+	return client, chainID, nil
+}
+
+// fail drops the connection after a transport error so the next call reconnects.
+// Errors the node answered with leave the connection alone.
+func (l *Logger) fail(ctx context.Context, client *ethclient.Client, err error) {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) || ctx.Err() != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.client != client {
+		return
+	}
+	l.client.Close()
+	l.client = nil
+	l.lastErr = err
+	log.Printf("Web3: Lost connection to the RPC endpoint: %v", err)
+}
+
+func (l *Logger) send(ctx context.Context, method string, args ...interface{}) (*types.Receipt, error) {
+	l.sendMu.Lock()
+	defer l.sendMu.Unlock()
+
+	data, err := l.abi.Pack(method, args...)
+	if err != nil {
+		return nil, err
+	}
+	client, chainID, err := l.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A retry of readings whose transaction timed out waits for it instead of
+	// sending them twice, unless the node has forgotten the transaction
+	tx := l.pending
+	if tx != nil && !bytes.Equal(tx.Data(), data) {
+		tx = nil
+	}
+	if tx != nil {
+		_, _, err := client.TransactionByHash(ctx, tx.Hash())
+		switch {
+		case errors.Is(err, ethereum.NotFound):
+			log.Printf("Web3: Transaction %s was dropped, sending %s again", tx.Hash().Hex(), method)
+			tx, l.nonce = nil, nil
+		case err != nil:
+			l.fail(ctx, client, err)
+			return nil, fmt.Errorf("failed to look up transaction %s: %w", tx.Hash().Hex(), err)
+		}
+	}
+	l.pending = nil
+	if tx == nil {
+		if tx, err = l.submit(ctx, client, chainID, method, data); err != nil {
+			return nil, err
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, ReceiptTimeout)
+	defer cancel()
+	receipt, err := bind.WaitMined(waitCtx, client, tx)
+	if err != nil {
+		l.pending = tx
+		return nil, fmt.Errorf("transaction %s is not mined yet: %w", tx.Hash().Hex(), err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return receipt, l.revertReason(ctx, client, method, tx, receipt)
+	}
+	return receipt, nil
+}
+
+// submit signs and sends a dynamic-fee transaction with the next local nonce
+func (l *Logger) submit(ctx context.Context, client *ethclient.Client, chainID *big.Int, method string, data []byte) (*types.Transaction, error) {
+	if l.nonce == nil {
+		nonce, err := client.PendingNonceAt(ctx, l.from)
+		if err != nil {
+			l.fail(ctx, client, err)
+			return nil, fmt.Errorf("failed to fetch nonce: %w", err)
+		}
+		l.nonce = &nonce
 	}
 
-	_, err := instance.StoreLog(auth, big.NewInt(int64(ph)), big.NewInt(int64(turbidity)))
-	return err
+	tip, feeCap, err := l.feeCaps(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := client.EstimateGas(ctx, ethereum.CallMsg{
+		From:      l.from,
+		To:        &l.contract,
+		GasFeeCap: feeCap,
+		GasTipCap: tip,
+		Data:      data,
+	})
+	if err != nil {
+		if revert := asRevert(method, err); revert != nil {
+			return nil, revert
+		}
+		l.fail(ctx, client, err)
+		return nil, fmt.Errorf("failed to estimate gas: %w", err)
+	}
+
+	tx, err := types.SignNewTx(l.key, types.LatestSignerForChainID(chainID), &types.DynamicFeeTx{
+		ChainID:   chainID,
+		Nonce:     *l.nonce,
+		GasTipCap: tip,
+		GasFeeCap: feeCap,
+		Gas:       gas + gas*uint64(l.fees.GasMarginPercent)/100,
+		To:        &l.contract,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	if err := client.SendTransaction(ctx, tx); err != nil {
+		var rpcErr rpc.Error
+		switch {
+		case errors.As(err, &rpcErr) && strings.Contains(err.Error(), "already known"):
+			// An earlier attempt reached the node after all
+		case errors.As(err, &rpcErr):
+			// The node knows the account better after a nonce or replacement error
+			l.nonce = nil
+			return nil, fmt.Errorf("failed to send %s: %w", method, err)
+		default:
+			// The node may have the transaction, so a retry looks it up rather than
+			// signing the readings again with another nonce
+			*l.nonce++
+			l.pending = tx
+			l.fail(ctx, client, err)
+			return nil, fmt.Errorf("sending %s in %s failed with an unknown outcome: %w", method, tx.Hash().Hex(), err)
+		}
+	}
+	*l.nonce++
+	log.Printf("Web3: Sent %s from %s in %s (nonce %d)", method, l.from.Hex(), tx.Hash().Hex(), tx.Nonce())
+	return tx, nil
+}
+
+// revertReason replays a reverted transaction on the state before its block to learn why it failed
+func (l *Logger) revertReason(ctx context.Context, client *ethclient.Client, method string, tx *types.Transaction, receipt *types.Receipt) error {
+	revert := &RevertError{Method: method, TxHash: tx.Hash()}
+	parent := new(big.Int).Sub(receipt.BlockNumber, big.NewInt(1))
+	_, err := client.CallContract(ctx, ethereum.CallMsg{From: l.from, To: tx.To(), Gas: tx.Gas(), Data: tx.Data()}, parent)
+	if r := asRevert(method, err); r != nil {
+		revert.Reason = r.Reason
+	} else if receipt.GasUsed == tx.Gas() {
+		revert.Reason = "out of gas"
+	}
+	return revert
+}
+
+// asRevert recognizes a node's "execution reverted" error and decodes its reason
+func asRevert(method string, err error) *RevertError {
+	if err == nil {
+		return nil
+	}
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if hexData, ok := dataErr.ErrorData().(string); ok {
+			if data, dErr := hexutil.Decode(hexData); dErr == nil {
+				reason, _ := abi.UnpackRevert(data)
+				return &RevertError{Method: method, Reason: reason}
+			}
+		}
+	}
+	msg := err.Error()
+	if i := strings.Index(msg, "execution reverted"); i >= 0 {
+		reason := strings.TrimPrefix(msg[i+len("execution reverted"):], ":")
+		return &RevertError{Method: method, Reason: strings.TrimSpace(reason)}
+	}
+	return nil
+}
+
+// feeCaps picks the dynamic-fee tip and cap of a transaction within the configured limits
+func (l *Logger) feeCaps(ctx context.Context, client *ethclient.Client) (tip, feeCap *big.Int, err error) {
+	fees := l.fees
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		l.fail(ctx, client, err)
+		return nil, nil, fmt.Errorf("failed to fetch latest header: %w", err)
+	}
+	if head.BaseFee == nil {
+		return nil, nil, errors.New("chain does not support EIP-1559 dynamic fees")
+	}
+	if fees.MaxFeePerGas != nil && head.BaseFee.Cmp(fees.MaxFeePerGas) > 0 {
+		return nil, nil, fmt.Errorf("base fee %s wei is above the configured max fee %s wei", head.BaseFee, fees.MaxFeePerGas)
+	}
+
+	tip, err = client.SuggestGasTipCap(ctx)
+	if err != nil {
+		l.fail(ctx, client, err)
+		return nil, nil, fmt.Errorf("failed to suggest gas tip: %w", err)
+	}
+	if fees.MaxTipPerGas != nil && tip.Cmp(fees.MaxTipPerGas) > 0 {
+		tip = new(big.Int).Set(fees.MaxTipPerGas)
+	}
+	feeCap = new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tip)
+	if fees.MaxFeePerGas != nil && feeCap.Cmp(fees.MaxFeePerGas) > 0 {
+		feeCap = new(big.Int).Set(fees.MaxFeePerGas)
+	}
+	if tip.Cmp(feeCap) > 0 {
+		tip = new(big.Int).Set(feeCap)
+	}
+	return tip, feeCap, nil
 }
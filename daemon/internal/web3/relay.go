@@ -0,0 +1,319 @@
+package web3
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/p2m-lite/core/daemon/internal/contract"
+)
+
+// Gas the forwarder passes on to storeLog/storeLogs. Appending a log costs about 100k gas.
+const (
+	relayBaseGas       = 60_000
+	relayGasPerReading = 120_000
+	relayDeadline      = 10 * time.Minute
+
+	// relayPollInterval is how often the outcome of a relayed request is polled
+	relayPollInterval = 5 * time.Second
+)
+
+// Outcomes of a relayed request as reported by /api/relay/requests/:nonce
+const (
+	relayPending = "pending"
+	relayMined   = "mined"
+	relayFailed  = "failed"
+	relayDropped = "dropped"
+)
+
+// ErrUnauthorized means the API did not accept the session token, the daemon has to sign in again
+var ErrUnauthorized = errors.New("relay rejected the session token")
+
+// errNotFound means the API does not know the requested resource
+var errNotFound = errors.New("not found")
+
+var (
+	domainTypeHash  = crypto.Keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"))
+	requestTypeHash = crypto.Keccak256([]byte("ForwardRequest(address from,address to,uint256 value,uint256 gas,uint256 nonce,uint256 deadline,bytes data)"))
+)
+
+// forwardRequest mirrors Forwarder.ForwardRequest and the JSON accepted by /api/relay/logs
+type forwardRequest struct {
+	From     common.Address `json:"from"`
+	To       common.Address `json:"to"`
+	Value    uint64         `json:"value"`
+	Gas      uint64         `json:"gas"`
+	Nonce    uint64         `json:"nonce"`
+	Deadline uint64         `json:"deadline"`
+	Data     hexutil.Bytes  `json:"data"`
+}
+
+// Relayer signs readings as EIP-712 meta-transactions and lets the API pay for submitting them
+type Relayer struct {
+	client      *http.Client
+	nonceURL    string
+	logsURL     string
+	requestsURL string
+	// chainID, when set, is the only chain requests are signed for
+	chainID *big.Int
+
+	sendMu sync.Mutex
+	// pending is the last request handed to the API that is not known to be mined yet
+	pending *forwardRequest
+}
+
+func NewRelayer(nonceURL, logsURL, requestsURL string, chainID *big.Int) *Relayer {
+	return &Relayer{
+		client:      &http.Client{Timeout: 30 * time.Second},
+		nonceURL:    nonceURL,
+		logsURL:     logsURL,
+		requestsURL: requestsURL,
+		chainID:     chainID,
+	}
+}
+
+// SendLog relays one reading as a storeLog call and waits until it is mined
+func (r *Relayer) SendLog(ctx context.Context, cAddr, token string, key *ecdsa.PrivateKey, ph, turbidity int) (common.Hash, error) {
+	return r.send(ctx, cAddr, token, key, 1, "storeLog", big.NewInt(int64(ph)), big.NewInt(int64(turbidity)))
+}
+
+// SendLogs relays several readings as one storeLogs call and waits until it is mined.
+// The slices must have equal length.
+func (r *Relayer) SendLogs(ctx context.Context, cAddr, token string, key *ecdsa.PrivateKey, ph, turbidity []int, timestamps []time.Time) (common.Hash, error) {
+	if len(turbidity) != len(ph) || len(timestamps) != len(ph) {
+		return common.Hash{}, errors.New("batch slices must have the same length")
+	}
+
+	phValues := make([]*big.Int, len(ph))
+	turbidityValues := make([]*big.Int, len(ph))
+	timestampValues := make([]*big.Int, len(ph))
+	for i := range ph {
+		phValues[i] = big.NewInt(int64(ph[i]))
+		turbidityValues[i] = big.NewInt(int64(turbidity[i]))
+		timestampValues[i] = big.NewInt(timestamps[i].Unix())
+	}
+	return r.send(ctx, cAddr, token, key, len(ph), "storeLogs", phValues, turbidityValues, timestampValues)
+}
+
+func (r *Relayer) send(ctx context.Context, cAddr, token string, key *ecdsa.PrivateKey, readings int, method string, args ...interface{}) (common.Hash, error) {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	parsed, err := contract.P2MContractMetaData.GetAbi()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	data, err := parsed.Pack(method, args...)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	// A retry of readings whose request may have reached the API waits for that
+	// request instead of signing them again, unless it can no longer be executed
+	req := r.pending
+	if req != nil && !bytes.Equal(req.Data, data) {
+		req = nil
+	}
+	if req != nil {
+		outcome, err := r.status(ctx, token, req.Nonce)
+		switch {
+		case errors.Is(err, errNotFound):
+			log.Printf("Web3: Relay request %d never reached the API, signing %s again", req.Nonce, method)
+			req = nil
+		case err != nil:
+			return common.Hash{}, fmt.Errorf("failed to look up relay request %d: %w", req.Nonce, err)
+		case outcome.Status == relayDropped:
+			log.Printf("Web3: Relay request %d was dropped, signing %s again", req.Nonce, method)
+			req = nil
+		}
+	}
+	r.pending = nil
+	if req == nil {
+		if req, err = r.submit(ctx, cAddr, token, key, readings, data); err != nil {
+			return common.Hash{}, fmt.Errorf("failed to relay %s: %w", method, err)
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, ReceiptTimeout)
+	defer cancel()
+	outcome, err := r.waitMined(waitCtx, token, req.Nonce)
+	if err != nil {
+		r.pending = req
+		return common.Hash{}, fmt.Errorf("relay request %d is not mined yet: %w", req.Nonce, err)
+	}
+	switch outcome.Status {
+	case relayMined:
+		return outcome.TxHash, nil
+	case relayFailed:
+		// An expired request fails whatever it carries, the readings may be signed again
+		if time.Now().Unix() > int64(req.Deadline) {
+			return common.Hash{}, fmt.Errorf("relay request %d expired before it was executed", req.Nonce)
+		}
+		return common.Hash{}, &RevertError{Method: method, TxHash: outcome.TxHash}
+	default:
+		return common.Hash{}, fmt.Errorf("relay request %d was dropped", req.Nonce)
+	}
+}
+
+type requestStatus struct {
+	Status string      `json:"status"`
+	TxHash common.Hash `json:"tx_hash"`
+}
+
+func (r *Relayer) status(ctx context.Context, token string, nonce uint64) (*requestStatus, error) {
+	var outcome requestStatus
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("%s/%d", r.requestsURL, nonce), token, nil, &outcome); err != nil {
+		return nil, err
+	}
+	return &outcome, nil
+}
+
+// waitMined polls the API until the request is no longer pending
+func (r *Relayer) waitMined(ctx context.Context, token string, nonce uint64) (*requestStatus, error) {
+	ticker := time.NewTicker(relayPollInterval)
+	defer ticker.Stop()
+	for {
+		outcome, err := r.status(ctx, token, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if outcome.Status != relayPending {
+			return outcome, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// submit signs the call for the next forwarder nonce and hands it to the API. The
+// request is kept as pending even when the API's answer is lost.
+func (r *Relayer) submit(ctx context.Context, cAddr, token string, key *ecdsa.PrivateKey, readings int, data []byte) (*forwardRequest, error) {
+	var target struct {
+		Forwarder common.Address `json:"forwarder"`
+		Contract  common.Address `json:"contract"`
+		ChainID   string         `json:"chain_id"`
+		Nonce     uint64         `json:"nonce"`
+	}
+	if err := r.do(ctx, http.MethodGet, r.nonceURL, token, nil, &target); err != nil {
+		return nil, fmt.Errorf("failed to fetch relay nonce: %w", err)
+	}
+	// Never sign calls to a contract other than the configured one
+	if cAddr != "" && !strings.EqualFold(target.Contract.Hex(), common.HexToAddress(cAddr).Hex()) {
+		return nil, fmt.Errorf("relay submits to %s, not the configured contract %s", target.Contract.Hex(), cAddr)
+	}
+	chainID, ok := new(big.Int).SetString(target.ChainID, 10)
+	if !ok {
+		return nil, fmt.Errorf("relay returned invalid chain id %q", target.ChainID)
+	}
+	if r.chainID != nil && chainID.Cmp(r.chainID) != 0 {
+		return nil, fmt.Errorf("relay is on chain %s, not the configured chain %s", chainID, r.chainID)
+	}
+
+	req := &forwardRequest{
+		From:     crypto.PubkeyToAddress(key.PublicKey),
+		To:       target.Contract,
+		Gas:      relayBaseGas + relayGasPerReading*uint64(readings),
+		Nonce:    target.Nonce,
+		Deadline: uint64(time.Now().Add(relayDeadline).Unix()),
+		Data:     data,
+	}
+	signature, err := crypto.Sign(req.digest(chainID, target.Forwarder).Bytes(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign relay request: %w", err)
+	}
+	signature[crypto.RecoveryIDOffset] += 27 // the forwarder expects v = 27/28 like ecrecover
+
+	var result struct {
+		TxHash common.Hash `json:"tx_hash"`
+	}
+	body := map[string]interface{}{"request": req, "signature": hexutil.Bytes(signature)}
+	r.pending = req
+	if err := r.do(ctx, http.MethodPost, r.logsURL, token, body, &result); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (r *Relayer) do(ctx context.Context, method, url, token string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON payload: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("server returned error status: %s, body: %s", resp.Status, string(b))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// digest is the EIP-712 hash of the request in the domain of the given forwarder
+func (r *forwardRequest) digest(chainID *big.Int, forwarder common.Address) common.Hash {
+	domainSeparator := crypto.Keccak256(
+		domainTypeHash,
+		crypto.Keccak256([]byte("P2MForwarder")),
+		crypto.Keccak256([]byte("1")),
+		math.U256Bytes(new(big.Int).Set(chainID)),
+		common.LeftPadBytes(forwarder.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(
+		requestTypeHash,
+		common.LeftPadBytes(r.From.Bytes(), 32),
+		common.LeftPadBytes(r.To.Bytes(), 32),
+		uint256(r.Value),
+		uint256(r.Gas),
+		uint256(r.Nonce),
+		uint256(r.Deadline),
+		crypto.Keccak256(r.Data),
+	)
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domainSeparator, structHash)
+}
+
+func uint256(n uint64) []byte {
+	return common.LeftPadBytes(new(big.Int).SetUint64(n).Bytes(), 32)
+}
@@ -0,0 +1,151 @@
+package web3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The expected digests were computed with go-ethereum's EIP-712 implementation
+// (signer/core/apitypes) over the ForwardRequest type of Forwarder.sol
+func TestDigest(t *testing.T) {
+	forwarder := common.HexToAddress("0x3333333333333333333333333333333333333333")
+	full := forwardRequest{
+		From:     common.HexToAddress("0x1111111111111111111111111111111111111111"),
+		To:       common.HexToAddress("0x2222222222222222222222222222222222222222"),
+		Gas:      300000,
+		Nonce:    7,
+		Deadline: 1700000000,
+		Data:     []byte{0xde, 0xad, 0xbe, 0xef},
+	}
+	empty := forwardRequest{
+		From: common.HexToAddress("0x00000000000000000000000000000000000000aa"),
+		To:   common.HexToAddress("0x00000000000000000000000000000000000000bb"),
+	}
+
+	tests := []struct {
+		name    string
+		req     forwardRequest
+		chainID int64
+		want    string
+	}{
+		{"testnet", full, 97, "0x0640e4754216b564ea2d5ce052511c2f027a8427dd4855831e3b510feb165232"},
+		{"mainnet", full, 56, "0x1e2335e9f442f01400021e80573f75a3faf13d6401de4c57400391f1423ae1b5"},
+		{"zero values and empty data", empty, 97, "0x3177c75ca4d7c3ab4cbb6423254e182246cb2ebe0c99cde42c687a9febedcff7"},
+		{"zero values on mainnet", empty, 56, "0x162bb1d5b81d008db4684d8b246d2c06ad6fba8396198ed349929fb0216a36ea"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.digest(big.NewInt(tt.chainID), forwarder); got != common.HexToHash(tt.want) {
+				t.Errorf("digest() = %s, want %s", got.Hex(), tt.want)
+			}
+		})
+	}
+}
+
+// fakeRelay plays the API relay: lostAnswers submissions are relayed but their
+// answer is lost, and statuses holds what each relayed nonce reports
+type fakeRelay struct {
+	mu          sync.Mutex
+	nonce       uint64
+	submissions int
+	lostAnswers int
+	statuses    map[uint64]string
+}
+
+func (f *fakeRelay) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /nonce", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"forwarder": "0x3333333333333333333333333333333333333333",
+			"contract":  "0x2222222222222222222222222222222222222222",
+			"chain_id":  "97",
+			"nonce":     f.nonce,
+		})
+	})
+	mux.HandleFunc("POST /logs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.submissions++
+		f.statuses[f.nonce] = relayMined
+		f.nonce++
+		if f.lostAnswers > 0 {
+			f.lostAnswers--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"tx_hash": common.Hash{1}.Hex()})
+	})
+	mux.HandleFunc("GET /requests/{nonce}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var nonce uint64
+		fmt.Sscan(r.PathValue("nonce"), &nonce)
+		status, ok := f.statuses[nonce]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"status": status, "tx_hash": common.Hash{1}.Hex()})
+	})
+	return mux
+}
+
+func TestRelayerResend(t *testing.T) {
+	tests := []struct {
+		name            string
+		lostAnswers     int
+		status          string // reported for the first request once relayed, mined if empty
+		wantSubmissions int
+		wantRevert      bool
+	}{
+		{"answer received", 0, "", 1, false},
+		{"lost answer is not signed again", 1, "", 1, false},
+		{"dropped request is signed again", 1, relayDropped, 2, false},
+		{"failed request is rejected", 1, relayFailed, 1, true},
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeRelay{lostAnswers: tt.lostAnswers, statuses: map[uint64]string{}}
+			server := httptest.NewServer(fake.handler())
+			defer server.Close()
+			relayer := NewRelayer(server.URL+"/nonce", server.URL+"/logs", server.URL+"/requests", big.NewInt(97))
+
+			_, err := relayer.SendLog(context.Background(), "", "token", key, 7, 3)
+			if tt.lostAnswers > 0 {
+				if err == nil {
+					t.Fatal("SendLog() succeeded although the answer was lost")
+				}
+				if tt.status != "" {
+					fake.mu.Lock()
+					fake.statuses[0] = tt.status
+					fake.mu.Unlock()
+				}
+				_, err = relayer.SendLog(context.Background(), "", "token", key, 7, 3)
+			}
+
+			var revert *RevertError
+			if gotRevert := errors.As(err, &revert); gotRevert != tt.wantRevert || (err != nil && !tt.wantRevert) {
+				t.Errorf("SendLog() error = %v, want revert %v", err, tt.wantRevert)
+			}
+			if fake.submissions != tt.wantSubmissions {
+				t.Errorf("submissions = %d, want %d", fake.submissions, tt.wantSubmissions)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
@@ -28,6 +29,8 @@ func main() {
 	rpcURL := os.Getenv("OPBNB_RPC_URL")
 	privKeyHex := os.Getenv("PRIVATE_KEY")
 	binFilePath := os.Getenv("BIN_FILE_PATH")
+	forwarderBinFilePath := os.Getenv("FORWARDER_BIN_FILE_PATH")
+	forwarderAddress := os.Getenv("FORWARDER_ADDRESS")
 
 	if rpcURL == "" || privKeyHex == "" || binFilePath == "" {
 		log.Fatal("Please set OPBNB_RPC_URL, PRIVATE_KEY, and BIN_FILE_PATH in .env")
@@ -56,8 +59,44 @@ func main() {
 	fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
 	fmt.Println("Deploying from address:", fromAddress.Hex())
 
-	// 4. Read the compiled bytecode (.bin file)
-	bytecodeBytes, err := os.ReadFile(binFilePath)
+	// 4. Get Network Chain ID
+	chainID, err := client.NetworkID(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Chain ID: %v\n", chainID)
+
+	// 5. Resolve the trusted forwarder: reuse a deployed one, deploy a new one or go without relaying
+	forwarder := common.Address{}
+	switch {
+	case forwarderAddress != "":
+		if !common.IsHexAddress(forwarderAddress) {
+			log.Fatalf("Invalid FORWARDER_ADDRESS %q", forwarderAddress)
+		}
+		forwarder = common.HexToAddress(forwarderAddress)
+	case forwarderBinFilePath != "":
+		fmt.Println("\nDeploying Forwarder...")
+		receipt, err := deploy(client, privateKey, chainID, readBytecode(forwarderBinFilePath))
+		if err != nil {
+			log.Fatal(err)
+		}
+		forwarder = receipt.ContractAddress
+	default:
+		log.Println("Warning: Neither FORWARDER_ADDRESS nor FORWARDER_BIN_FILE_PATH is set. Readings cannot be relayed.")
+	}
+	fmt.Println("Trusted Forwarder:", forwarder.Hex())
+
+	// 6. Deploy P2M, its constructor takes the forwarder address as a single ABI encoded word
+	fmt.Println("\nDeploying P2M...")
+	contractBytecode := append(readBytecode(binFilePath), common.LeftPadBytes(forwarder.Bytes(), 32)...)
+	if _, err := deploy(client, privateKey, chainID, contractBytecode); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readBytecode reads a compiled .bin file
+func readBytecode(path string) []byte {
+	bytecodeBytes, err := os.ReadFile(path)
 	if err != nil {
 		log.Fatalf("Failed to read bin file: %v", err)
 	}
@@ -68,29 +107,28 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to decode bytecode hex: %v", err)
 	}
+	return contractBytecode
+}
 
-	// 5. Get Network Chain ID
-	chainID, err := client.NetworkID(context.Background())
-	if err != nil {
-		log.Fatal(err)
-	}
-	fmt.Printf("Chain ID: %v\n", chainID)
+// deploy sends a contract creation transaction and waits until it is mined
+func deploy(client *ethclient.Client, privateKey *ecdsa.PrivateKey, chainID *big.Int, contractBytecode []byte) (*types.Receipt, error) {
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
 
-	// 6. Get Nonce
+	// Get Nonce
 	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	// 7. Estimate Gas Price and Limit
+	// Estimate Gas Price and Limit
 	gasTipCap, err := client.SuggestGasTipCap(context.Background())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	head, err := client.HeaderByNumber(context.Background(), nil)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	gasFeeCap := new(big.Int).Add(head.BaseFee, gasTipCap)
 
@@ -105,14 +143,14 @@ func main() {
 
 	gasLimit, err := client.EstimateGas(context.Background(), msg)
 	if err != nil {
-		log.Fatalf("Failed to estimate gas: %v", err)
+		return nil, fmt.Errorf("failed to estimate gas: %w", err)
 	}
 
 	// Add a small buffer to gas limit for safety
 	gasLimit = gasLimit + (gasLimit / 10)
 	fmt.Printf("Estimated Gas: %v\n", gasLimit)
 
-	// 8. Create Transaction (EIP-1559 Dynamic Fee)
+	// Create Transaction (EIP-1559 Dynamic Fee)
 	txData := &types.DynamicFeeTx{
 		ChainID:   chainID,
 		Nonce:     nonce,
@@ -126,32 +164,36 @@ func main() {
 
 	tx := types.NewTx(txData)
 
-	// 9. Sign Transaction
+	// Sign Transaction
 	signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), privateKey)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	// 10. Broadcast Transaction
+	// Broadcast Transaction
 	err = client.SendTransaction(context.Background(), signedTx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	fmt.Printf("\n--- Transaction Sent! ---\n")
 	fmt.Printf("Tx Hash: %s\n", signedTx.Hash().Hex())
 	fmt.Println("Waiting for mining...")
 
-	// 11. Wait for Receipt
+	// Wait for Receipt
 	receipt, err := bindWaitMined(context.Background(), client, signedTx)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return nil, fmt.Errorf("deployment %s reverted", signedTx.Hash().Hex())
 	}
 
 	fmt.Printf("\n--- Contract Deployed! ---\n")
 	fmt.Printf("Contract Address: %s\n", receipt.ContractAddress.Hex())
 	fmt.Printf("Block Number: %v\n", receipt.BlockNumber)
 	fmt.Printf("Gas Used: %v\n", receipt.GasUsed)
+	return receipt, nil
 }
 
 // Helper to wait for mining (simplified version of bind.WaitMined)